@@ -3,6 +3,7 @@ package cmd
 import (
 	"github.com/charmbracelet/log"
 	"github.com/spf13/cobra"
+	"os"
 )
 
 var buildCmd = &cobra.Command{
@@ -13,21 +14,73 @@ var buildCmd = &cobra.Command{
 	Run:   buildFunc,
 }
 
+var (
+	cleanFlag    bool
+	jobsFlag     int
+	manifestFlag bool
+	reportFlag   bool
+
+	buildTimeFlag string
+	checkFlag     bool
+)
+
 func buildFunc(cmd *cobra.Command, args []string) {
 	config := GetConfig()
+	config.Clean = config.Clean || cleanFlag
+	config.Manifest = config.Manifest || manifestFlag
 
 	if !exists(config.Src) {
 		log.Error("source directory doesn't exist", "directory", config.Src)
+		os.Exit(1)
+	}
+
+	opts := makeOpts(config)
+	opts.Jobs = jobsFlag
+
+	buildTime, err := parseBuildTime(buildTimeFlag)
+	if err != nil {
+		log.Error("invalid build time", "error", err)
+		os.Exit(1)
 	}
+	opts.BuildTime = buildTime
 
-	if err := buildSite(config.Src, config.Dst, makeOpts(config)); err != nil {
+	if err := runCommands("pre_build", config.PreBuild, config, ModeBuild); err != nil {
 		log.Error("failed to build site", "error", err)
+		os.Exit(1)
+	}
+
+	if checkFlag {
+		if err := checkReproducible(config, *opts); err != nil {
+			logBuildError("site isn't reproducible", err)
+			os.Exit(1)
+		}
 		return
 	}
 
+	site, err := buildSite(config, opts)
+	if err != nil {
+		logBuildError("failed to build site", err)
+		os.Exit(1)
+	}
+
+	if err := runCommands("post_build", config.PostBuild, config, ModeBuild); err != nil {
+		log.Error("failed to build site", "error", err)
+		os.Exit(1)
+	}
+
 	log.Info("built site successfully")
+
+	if reportFlag {
+		printReport(os.Stdout, site.Manifest())
+	}
 }
 
 func init() {
+	buildCmd.Flags().BoolVarP(&cleanFlag, "clean", "c", false, "Rewrite every file, rather than keeping files unchanged since the last build")
+	buildCmd.Flags().IntVarP(&jobsFlag, "jobs", "j", 0, "Number of pages to render at once (default GOMAXPROCS)")
+	buildCmd.Flags().BoolVar(&manifestFlag, "manifest", false, "Write build-manifest.json, listing every file built, to the output")
+	buildCmd.Flags().BoolVar(&reportFlag, "report", false, "Print a summary of the build")
+	buildCmd.Flags().StringVar(&buildTimeFlag, "build-time", "", "Time to build at, in seconds since the epoch or RFC 3339 (default $SOURCE_DATE_EPOCH, or now)")
+	buildCmd.Flags().BoolVar(&checkFlag, "check-reproducible", false, "Build the site twice in memory and report any files which differ, without writing it")
 	rootCmd.AddCommand(buildCmd)
 }
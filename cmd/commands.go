@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/charmbracelet/log"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// Commands is a list of shell commands, run one after another.
+// In shizuka_conf.json it may be written as either a single command or a list of commands.
+type Commands []string
+
+func (c *Commands) UnmarshalJSON(b []byte) error {
+	var command string
+	if err := json.Unmarshal(b, &command); err == nil {
+		*c = Commands{command}
+		return nil
+	}
+
+	var commands []string
+	if err := json.Unmarshal(b, &commands); err != nil {
+		return err
+	}
+
+	*c = commands
+	return nil
+}
+
+// The modes a build is run in, given to commands in SHIZUKA_MODE.
+const (
+	ModeBuild = "build"
+	ModeDev   = "dev"
+)
+
+// commandEnv returns the environment commands run in: that of shizuka, along with the absolute
+// source and destination paths and the build mode.
+func commandEnv(config Config, mode string) ([]string, error) {
+	src, err := filepath.Abs(config.Src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find source directory: %w", err)
+	}
+
+	dst, err := filepath.Abs(config.Dst)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find destination directory: %w", err)
+	}
+
+	return append(os.Environ(),
+		"SHIZUKA_SRC="+src,
+		"SHIZUKA_DST="+dst,
+		"SHIZUKA_MODE="+mode,
+	), nil
+}
+
+// runCommands runs each of commands in turn through the shell, stopping at the first which fails.
+// name is the config field the commands came from, e.g. "pre_build", and prefixes their output.
+func runCommands(name string, commands Commands, config Config, mode string) error {
+	if len(commands) == 0 {
+		return nil
+	}
+
+	env, err := commandEnv(config, mode)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	for _, command := range commands {
+		if err := runCommand(name, command, env); err != nil {
+			return fmt.Errorf("%s command %q failed: %w", name, command, err)
+		}
+	}
+
+	return nil
+}
+
+// runCommand runs a single command, logging each line it writes to stdout as info and to stderr as
+// a warning.
+func runCommand(name, command string, env []string) error {
+	log.Info("running "+name, "command", command)
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Env = env
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	logger := log.WithPrefix(name)
+
+	// the pipes must be read to the end before waiting for the command
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		logLines(stdout, logger.Info)
+	}()
+	go func() {
+		defer wg.Done()
+		logLines(stderr, logger.Warn)
+	}()
+	wg.Wait()
+
+	return cmd.Wait()
+}
+
+// logLines logs each line read from r until it is closed.
+func logLines(r io.Reader, logf func(msg any, keyvals ...any)) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		logf(scanner.Text())
+	}
+
+	// drain whatever is left, such as the rest of an overlong line, so the command isn't blocked
+	_, _ = io.Copy(io.Discard, r)
+}
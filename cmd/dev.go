@@ -6,9 +6,11 @@ import (
 	"github.com/fsnotify/fsnotify"
 	"github.com/gorilla/websocket"
 	"github.com/spf13/cobra"
+	"maps"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 )
@@ -53,9 +55,30 @@ func devFunc(cmd *cobra.Command, args []string) {
 	opts := makeOpts(config)
 	opts.Dev = true
 	opts.DevScript = liveReloadScript
+	opts.Jobs = jobsFlag
+
+	// the output is served while it's rebuilt, so is written in place rather than swapped in
+	out := makeOutput(config)
+	out.InPlace = true
+
+	// the page builder is kept between builds, so that rebuilds only redo what has changed
+	site := newPageBuilder(config, out)
+	site.Opts = *opts
+
+	if err := runCommands("pre_build", config.PreBuild, config, ModeDev); err != nil {
+		log.Error("initial build failed", "error", err)
+		os.Exit(1)
+		return
+	}
 
 	// initial build
-	if err := buildSite(config.Src, config.Dst, opts); err != nil {
+	if err := indexAndBuild(site); err != nil {
+		logBuildError("initial build failed", err)
+		os.Exit(1)
+		return
+	}
+
+	if err := runCommands("post_build", config.PostBuild, config, ModeDev); err != nil {
 		log.Error("initial build failed", "error", err)
 		os.Exit(1)
 		return
@@ -76,7 +99,7 @@ func devFunc(cmd *cobra.Command, args []string) {
 			clientsMu.Unlock()
 		})
 
-		http.Handle("/", http.StripPrefix("/", http.FileServer(http.Dir(config.Dst))))
+		http.Handle("/", fileServer(config.Dst, makeLanguages(config)))
 
 		err := http.ListenAndServe(fmt.Sprintf(":%s", config.Port), nil)
 		if err != nil {
@@ -95,35 +118,70 @@ func devFunc(cmd *cobra.Command, args []string) {
 		}
 		defer watcher.Close()
 
-		err = filepath.Walk(config.Src, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-			if info.IsDir() {
-				return watcher.Add(path)
+		for _, root := range append([]string{config.Src}, config.Theme...) {
+			if err := watchDirs(watcher, root); err != nil {
+				log.Error("watcher init error", "error", err)
+				os.Exit(1)
 			}
-			return nil
-		})
-		if err != nil {
-			log.Error("watcher init error", "error", err)
-			os.Exit(1)
 		}
 
-		var lastBuild time.Time
-		const debounceDuration = 500 * time.Millisecond
+		// changes are collected until none have happened for debounceDuration, so that saving several
+		// files at once only causes one rebuild
+		const debounceDuration = 100 * time.Millisecond
+		changed := make(map[string]bool)
+		var debounce <-chan time.Time
+
+		// pre_build runs before every rebuild. As its commands often write to the source, changes are
+		// collected for another debounceDuration once it has run, and rebuilt along with the changes
+		// which set it off rather than setting it off again. If it fails, the changes are kept for
+		// the next rebuild, while what it wrote is left to settle without running it again.
+		const (
+			preBuildIdle = iota
+			preBuildDone
+			preBuildFailed
+		)
+		preBuild := preBuildIdle
 
 		for {
 			select {
 			case event := <-watcher.Events:
 				if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 {
-					if time.Since(lastBuild) > debounceDuration {
-						if err := buildSite(config.Src, config.Dst, opts); err != nil {
-							log.Error("build failed", "error", err)
-						} else {
-							notifyClients()
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() && event.Op&fsnotify.Create != 0 {
+						if err := watchDirs(watcher, event.Name); err != nil {
+							log.Warn("failed to watch new directory", "directory", event.Name, "error", err)
 						}
-						lastBuild = time.Now()
 					}
+
+					changed[event.Name] = true
+					debounce = time.After(debounceDuration)
+				}
+			case <-debounce:
+				debounce = nil
+
+				switch {
+				case preBuild == preBuildFailed:
+					preBuild = preBuildIdle
+					continue
+				case preBuild == preBuildIdle && len(config.PreBuild) > 0:
+					preBuild = preBuildDone
+					if err := runCommands("pre_build", config.PreBuild, config, ModeDev); err != nil {
+						log.Error("build failed", "error", err)
+						preBuild = preBuildFailed
+					}
+					debounce = time.After(debounceDuration)
+					continue
+				}
+				preBuild = preBuildIdle
+
+				paths := slices.Sorted(maps.Keys(changed))
+				clear(changed)
+
+				if err := site.Rebuild(sourcePaths(config, paths)); err != nil {
+					logBuildError("build failed", err)
+				} else if err := runCommands("post_build", config.PostBuild, config, ModeDev); err != nil {
+					log.Error("build failed", "error", err)
+				} else {
+					notifyClients()
 				}
 			case err := <-watcher.Errors:
 				log.Error("watcher error", "error", err)
@@ -134,6 +192,36 @@ func devFunc(cmd *cobra.Command, args []string) {
 	select {} // run forever
 }
 
+// watchDirs adds root and every directory below it to watcher.
+func watchDirs(watcher *fsnotify.Watcher, root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return watcher.Add(path)
+		}
+		return nil
+	})
+}
+
+// sourcePaths turns the paths of changed files into the slash-separated paths the site knows them by,
+// relative to the source directory or the theme they are in.
+func sourcePaths(config Config, paths []string) []string {
+	var result []string
+	for _, p := range paths {
+		for _, root := range append([]string{config.Src}, config.Theme...) {
+			rel, err := filepath.Rel(root, p)
+			if err == nil && filepath.IsLocal(rel) {
+				result = append(result, filepath.ToSlash(rel))
+				break
+			}
+		}
+	}
+
+	return result
+}
+
 // Notify connected clients to reload
 func notifyClients() {
 	clientsMu.Lock()
@@ -148,5 +236,6 @@ func notifyClients() {
 }
 
 func init() {
+	devCmd.Flags().IntVarP(&jobsFlag, "jobs", "j", 0, "Number of pages to render at once (default GOMAXPROCS)")
 	rootCmd.AddCommand(devCmd)
 }
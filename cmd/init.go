@@ -37,8 +37,8 @@ func initFunc(cmd *cobra.Command, args []string) {
 
 	log.Info("created project!")
 
-	if err := buildSite(DefaultConf.Src, DefaultConf.Dst, makeOpts(DefaultConf)); err != nil {
-		log.Error("failed to build site", "err", err)
+	if _, err := buildSite(DefaultConf, makeOpts(DefaultConf)); err != nil {
+		logBuildError("failed to build site", err)
 		return
 	}
 
@@ -98,13 +98,16 @@ func makeTemplate(src string) error {
 
 	// Copy embedded files
 	files := map[string]string{
-		"embed/index.md":   "content/index.md",
-		"embed/post_1.md":  "content/posts/1.md",
-		"embed/post_2.md":  "content/posts/2.md",
-		"embed/post_3.md":  "content/posts/3.md",
-		"embed/styles.css": "static/styles.css",
-		"embed/index.tmpl": "templates/index.tmpl",
-		"embed/post.tmpl":  "templates/post.tmpl",
+		"embed/index.md":      "content/index.md",
+		"embed/post_1.md":     "content/posts/1.md",
+		"embed/post_2.md":     "content/posts/2.md",
+		"embed/post_3.md":     "content/posts/3.md",
+		"embed/styles.css":    "static/styles.css",
+		"embed/index.tmpl":    "templates/index.tmpl",
+		"embed/post.tmpl":     "templates/post.tmpl",
+		"embed/section.tmpl":  "templates/section.tmpl",
+		"embed/taxonomy.tmpl": "templates/taxonomy.tmpl",
+		"embed/term.tmpl":     "templates/term.tmpl",
 	}
 	for id, path := range files {
 		fullPath := filepath.Join(src, path)
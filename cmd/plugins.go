@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"github.com/e74000/shizuka/shizuka"
+	"os"
+)
+
+// plugins are registered on every page builder the commands create.
+var plugins []shizuka.Plugin
+
+// Use registers plugins to take part in every build the commands run. A custom main can call it
+// before Execute to build sites with plugins of its own.
+func Use(p ...shizuka.Plugin) {
+	plugins = append(plugins, p...)
+}
+
+// newPageBuilder creates a page builder for the configured source, writing to out, with the
+// registered plugins.
+func newPageBuilder(config Config, out shizuka.Output) *shizuka.PageBuilder {
+	pb := shizuka.NewPageBuilder(os.DirFS(config.Src), out)
+	pb.Use(plugins...)
+
+	return pb
+}
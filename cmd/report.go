@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"github.com/e74000/shizuka/shizuka"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// reportTop is how many of the largest pages and slowest templates the report lists.
+const reportTop = 5
+
+// templateTime is the time spent rendering one template over a build.
+type templateTime struct {
+	name  string
+	pages int
+	total time.Duration
+	max   time.Duration
+}
+
+// printReport writes a summary of what a build wrote: page counts by section, the largest pages, the
+// slowest templates and any warnings. Pages are the files rendered from a template.
+func printReport(w io.Writer, manifest *shizuka.Manifest) {
+	var pages []shizuka.ManifestFile
+	totalSize := 0
+	sections := make(map[string]int)
+	templates := make(map[string]*templateTime)
+
+	for _, file := range manifest.Files {
+		totalSize += file.Size
+		if file.Template == "" {
+			continue
+		}
+
+		pages = append(pages, file)
+		sections[sectionOf(file.Path)]++
+
+		t := templates[file.Template]
+		if t == nil {
+			t = &templateTime{name: file.Template}
+			templates[file.Template] = t
+		}
+		t.pages++
+		t.total += file.RenderTime
+		t.max = max(t.max, file.RenderTime)
+	}
+
+	fmt.Fprintf(w, "Built %d files (%s), %d of them pages\n", len(manifest.Files), formatSize(totalSize), len(pages))
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "\nPages by section")
+	for _, section := range slices.Sorted(maps.Keys(sections)) {
+		fmt.Fprintf(tw, "  %s\t%d\n", section, sections[section])
+	}
+
+	slices.SortStableFunc(pages, func(a, b shizuka.ManifestFile) int {
+		return cmp.Compare(b.Size, a.Size)
+	})
+
+	fmt.Fprintln(tw, "\nLargest pages")
+	for _, page := range pages[:min(reportTop, len(pages))] {
+		fmt.Fprintf(tw, "  %s\t%s\n", page.Path, formatSize(page.Size))
+	}
+
+	slowest := slices.SortedFunc(maps.Values(templates), func(a, b *templateTime) int {
+		return cmp.Or(cmp.Compare(b.total, a.total), strings.Compare(a.name, b.name))
+	})
+
+	fmt.Fprintln(tw, "\nSlowest templates")
+	for _, t := range slowest[:min(reportTop, len(slowest))] {
+		fmt.Fprintf(tw, "  %s\t%d page(s)\t%s total\t%s max\n", t.name, t.pages, t.total.Round(time.Microsecond), t.max.Round(time.Microsecond))
+	}
+
+	if len(manifest.Warnings) > 0 {
+		fmt.Fprintf(tw, "\nWarnings (%d)\n", len(manifest.Warnings))
+		for _, warning := range manifest.Warnings {
+			fmt.Fprintf(tw, "  %s\n", warning)
+		}
+	}
+
+	_ = tw.Flush()
+}
+
+// sectionOf returns the top level section an output path is in, or "/" for pages at the root.
+func sectionOf(outputPath string) string {
+	section, _, ok := strings.Cut(outputPath, "/")
+	if !ok {
+		return "/"
+	}
+
+	return section
+}
+
+// formatSize formats a number of bytes for people to read.
+func formatSize(size int) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/charmbracelet/log"
+	"github.com/e74000/shizuka/shizuka"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SourceDateEpochEnv is the environment variable giving the time to build at, in seconds since the
+// Unix epoch, as described at https://reproducible-builds.org/specs/source-date-epoch/.
+const SourceDateEpochEnv = "SOURCE_DATE_EPOCH"
+
+// parseBuildTime returns the time to build the site at: value if given, otherwise SOURCE_DATE_EPOCH
+// if set, otherwise the zero time, which builds at the current time. value may be either seconds since
+// the Unix epoch or an RFC 3339 timestamp.
+func parseBuildTime(value string) (time.Time, error) {
+	if value == "" {
+		value = os.Getenv(SourceDateEpochEnv)
+	}
+
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("build time %q is neither seconds since the epoch nor an RFC 3339 timestamp", value)
+	}
+
+	return t, nil
+}
+
+// manifestName is the name of the build manifest in the output.
+var manifestName = strings.TrimPrefix(shizuka.ManifestPath, "/")
+
+// withoutRenderTimes re-encodes a build manifest with every render time zeroed.
+func withoutRenderTimes(content []byte) ([]byte, error) {
+	var manifest shizuka.Manifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to read build manifest: %w", err)
+	}
+
+	for i := range manifest.Files {
+		manifest.Files[i].RenderTime = 0
+	}
+
+	return json.MarshalIndent(manifest, "", "  ")
+}
+
+// checkReproducible builds the site twice in memory, without touching the destination, and reports
+// every file which differs between the two builds. The second build renders one page at a time, so
+// that output which depends on how pages were scheduled shows up too. Render times naturally differ,
+// so are left out of the build manifests before they are compared.
+func checkReproducible(config Config, opts shizuka.BuildOpts) error {
+	// both builds must agree on the time, and must process images themselves rather than both
+	// reading them from, or leaving them in, the cache
+	if opts.BuildTime.IsZero() {
+		opts.BuildTime = time.Now()
+	}
+	opts.Images.CacheDir = ""
+
+	var builds [2]map[string][]byte
+	for i := range builds {
+		out := shizuka.NewMapOutput()
+		pb := newPageBuilder(config, out)
+		pb.Opts = opts
+		if i == 1 {
+			pb.Opts.Jobs = 1
+		}
+
+		if err := indexAndBuild(pb); err != nil {
+			return err
+		}
+
+		if manifest, ok := out.Files[manifestName]; ok {
+			stripped, err := withoutRenderTimes(manifest)
+			if err != nil {
+				return err
+			}
+			out.Files[manifestName] = stripped
+		}
+
+		builds[i] = out.Files
+	}
+
+	names := slices.Sorted(maps.Keys(builds[0]))
+	for name := range builds[1] {
+		if _, ok := builds[0][name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	differ := 0
+	for _, name := range names {
+		first, inFirst := builds[0][name]
+		second, inSecond := builds[1][name]
+
+		switch {
+		case !inFirst:
+			log.Error("file only in second build", "path", name)
+		case !inSecond:
+			log.Error("file only in first build", "path", name)
+		case !bytes.Equal(first, second):
+			log.Error("file differs between builds", "path", name)
+		default:
+			continue
+		}
+
+		differ++
+	}
+
+	if differ > 0 {
+		return fmt.Errorf("%d of %d files differ between builds", differ, len(names))
+	}
+
+	log.Info("builds are identical", "files", len(names))
+	return nil
+}
@@ -2,9 +2,12 @@ package cmd
 
 import (
 	"github.com/charmbracelet/log"
+	"github.com/e74000/shizuka/shizuka"
 	"github.com/spf13/cobra"
 	"net/http"
 	"os"
+	"path"
+	"path/filepath"
 )
 
 var serveCmd = &cobra.Command{
@@ -27,13 +30,50 @@ func serveFunc(cmd *cobra.Command, args []string) {
 
 	log.Info("running server on http://localhost:" + config.Port)
 
-	http.Handle("/", http.StripPrefix("/", http.FileServer(http.Dir(config.Dst))))
+	http.Handle("/", fileServer(config.Dst, makeLanguages(config)))
 	if err := http.ListenAndServe(":"+config.Port, nil); err != nil {
 		log.Error("failed to start server", "error", err)
 		os.Exit(1)
 	}
 }
 
+// fileServer serves the files in dir, responding to missing paths with the site's 404.html when it
+// has one, so that previews behave like a static host. Missing paths under a language's prefix get
+// that language's 404.html, such as /ja/404.html, falling back to the one at the root.
+func fileServer(dir string, languages shizuka.Languages) http.Handler {
+	files := http.FileServer(http.Dir(dir))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		urlPath := path.Clean("/" + r.URL.Path)
+		filePath := filepath.Join(dir, filepath.FromSlash(urlPath))
+
+		info, err := os.Stat(filePath)
+		if err == nil && info.IsDir() {
+			_, err = os.Stat(filepath.Join(filePath, "index.html"))
+		}
+
+		if err == nil {
+			files.ServeHTTP(w, r)
+			return
+		}
+
+		prefix := languages.Prefix(languages.Match(urlPath))
+
+		notFound, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(prefix+shizuka.NotFoundPath)))
+		if err != nil && prefix != "" {
+			notFound, err = os.ReadFile(filepath.Join(dir, shizuka.NotFoundPath))
+		}
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write(notFound)
+	})
+}
+
 func init() {
 	rootCmd.AddCommand(serveCmd)
 }
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/charmbracelet/log"
 	"github.com/e74000/shizuka/shizuka"
 	"os"
@@ -19,6 +20,10 @@ var DefaultConf = Config{
 	UseSitemap: false,
 	UseRSS:     false,
 	BaseURL:    "",
+
+	Taxonomies: []string{"tags"},
+
+	Keep: []string{".git", "CNAME", ".nojekyll"},
 }
 
 // Config represents the structure of shizuka_conf.json
@@ -35,6 +40,58 @@ type Config struct {
 	SiteTitle       string `json:"site_title"`
 	SiteDescription string `json:"site_description"`
 	SiteLang        string `json:"site_lang"`
+
+	Taxonomies []string `json:"taxonomies"`
+
+	Theme Themes `json:"theme,omitempty"`
+
+	Outputs       map[string][]string             `json:"outputs,omitempty"`
+	OutputFormats map[string]shizuka.OutputFormat `json:"output_formats,omitempty"`
+
+	SectionTemplate string `json:"section_template,omitempty"`
+
+	Languages       []shizuka.Language `json:"languages,omitempty"`
+	DefaultLanguage string             `json:"default_language,omitempty"`
+
+	// options which are structs are pointers, so that they're left out of a written config when unset
+	Related *shizuka.RelatedOpts `json:"related,omitempty"`
+
+	Generators []shizuka.Generator `json:"generators,omitempty"`
+
+	Assets *shizuka.AssetOpts `json:"assets,omitempty"`
+	Images *shizuka.ImageOpts `json:"images,omitempty"`
+
+	Minify *shizuka.MinifyOpts `json:"minify,omitempty"`
+
+	Clean bool `json:"clean,omitempty"`
+
+	Manifest bool `json:"manifest,omitempty"`
+
+	PreBuild  Commands `json:"pre_build,omitempty"`
+	PostBuild Commands `json:"post_build,omitempty"`
+
+	AllowExternalDst bool     `json:"allow_external_dst,omitempty"`
+	Keep             []string `json:"keep"`
+}
+
+// Themes is a list of theme directories, highest precedence first.
+// In shizuka_conf.json it may be written as either a single path or a list of paths.
+type Themes []string
+
+func (t *Themes) UnmarshalJSON(b []byte) error {
+	var theme string
+	if err := json.Unmarshal(b, &theme); err == nil {
+		*t = Themes{theme}
+		return nil
+	}
+
+	var themes []string
+	if err := json.Unmarshal(b, &themes); err != nil {
+		return err
+	}
+
+	*t = themes
+	return nil
 }
 
 // GetConfig loads the configuration from shizuka_conf.json or returns default values.
@@ -46,6 +103,8 @@ func GetConfig() Config {
 		Port:       DefaultConf.Port,
 		UseSitemap: DefaultConf.UseSitemap,
 		BaseURL:    DefaultConf.BaseURL,
+		Taxonomies: DefaultConf.Taxonomies,
+		Keep:       DefaultConf.Keep,
 	}
 
 	// Open shizuka_conf.json
@@ -77,6 +136,12 @@ func GetConfig() Config {
 	if config.BaseURL == "" {
 		config.BaseURL = defaultConfig.BaseURL
 	}
+	if config.Keep == nil {
+		config.Keep = defaultConfig.Keep
+	}
+	if config.Taxonomies == nil {
+		config.Taxonomies = defaultConfig.Taxonomies
+	}
 
 	return config
 }
@@ -102,12 +167,28 @@ func WriteConfig(config Config) error {
 	return nil
 }
 
-func buildSite(src, dst string, opts *shizuka.BuildOpts) error {
-	pb := shizuka.NewPageBuilder(src, dst)
+// makeOutput creates the output for the configured destination directory.
+func makeOutput(config Config) *shizuka.DirOutput {
+	return &shizuka.DirOutput{
+		Dir:              config.Dst,
+		Src:              config.Src,
+		AllowExternalDst: config.AllowExternalDst,
+		Keep:             config.Keep,
+		Clean:            config.Clean,
+	}
+}
+
+func buildSite(config Config, opts *shizuka.BuildOpts) (*shizuka.PageBuilder, error) {
+	pb := newPageBuilder(config, makeOutput(config))
 	if opts != nil {
 		pb.Opts = *opts
 	}
 
+	return pb, indexAndBuild(pb)
+}
+
+// indexAndBuild indexes and builds the whole site.
+func indexAndBuild(pb *shizuka.PageBuilder) error {
 	if err := pb.Index(); err != nil {
 		return err
 	}
@@ -119,12 +200,97 @@ func buildSite(src, dst string, opts *shizuka.BuildOpts) error {
 	return nil
 }
 
+// logBuildError reports a failed build, listing every page which failed to index, or every render
+// error grouped by template file.
+func logBuildError(msg string, err error) {
+	var indexErr *shizuka.IndexError
+	if errors.As(err, &indexErr) {
+		log.Error(msg, "failed", len(indexErr.Errors))
+
+		for _, e := range indexErr.Errors {
+			log.Error("  index failed", "source", e.Source, "error", e.Err)
+		}
+		return
+	}
+
+	var buildErr *shizuka.BuildError
+	if !errors.As(err, &buildErr) {
+		log.Error(msg, "error", err)
+		return
+	}
+
+	log.Error(msg, "failed", len(buildErr.Errors))
+
+	files, groups := buildErr.Grouped()
+	for _, file := range files {
+		log.Errorf("%s: %d error(s)", file, len(groups[file]))
+
+		for _, e := range groups[file] {
+			keyvals := []any{"page", e.Path}
+			if e.Source != "" {
+				keyvals = append(keyvals, "source", e.Source)
+			}
+			if e.Line > 0 {
+				keyvals = append(keyvals, "line", e.Line, "col", e.Column)
+			}
+			if e.Action != "" {
+				keyvals = append(keyvals, "action", e.Action)
+			}
+			keyvals = append(keyvals, "error", e.Err)
+
+			log.Error("  render failed", keyvals...)
+		}
+	}
+}
+
 func exists(filename string) bool {
 	_, err := os.Stat(filename)
 	return err == nil
 }
 
+// makeLanguages resolves the default language and URL prefixes of the configured languages.
+// The default language falls back to site_lang and then the first language listed, and every other
+// language is given a prefix of its code unless it sets one.
+func makeLanguages(config Config) shizuka.Languages {
+	languages := shizuka.Languages{
+		Default: config.DefaultLanguage,
+		List:    make([]shizuka.Language, len(config.Languages)),
+	}
+
+	if languages.Default == "" {
+		languages.Default = config.SiteLang
+	}
+	if languages.Default == "" && len(config.Languages) > 0 {
+		languages.Default = config.Languages[0].Code
+	}
+
+	for i, lang := range config.Languages {
+		if lang.Prefix == "" && lang.Code != languages.Default {
+			lang.Prefix = "/" + lang.Code
+		}
+
+		languages.List[i] = lang
+	}
+
+	return languages
+}
+
+// deref returns the value p points to, or the zero value if p is nil.
+func deref[T any](p *T) T {
+	if p == nil {
+		var zero T
+		return zero
+	}
+
+	return *p
+}
+
 func makeOpts(config Config) *shizuka.BuildOpts {
+	images := deref(config.Images)
+	if images.CacheDir == "" {
+		images.CacheDir = shizuka.DefaultImageCacheDir
+	}
+
 	return &shizuka.BuildOpts{
 		UseSitemap:      config.UseSitemap,
 		UseRss:          config.UseRSS,
@@ -132,5 +298,17 @@ func makeOpts(config Config) *shizuka.BuildOpts {
 		SiteTitle:       config.SiteTitle,
 		SiteDescription: config.SiteDescription,
 		SiteLang:        config.SiteLang,
+		Taxonomies:      config.Taxonomies,
+		Themes:          config.Theme,
+		Outputs:         config.Outputs,
+		OutputFormats:   config.OutputFormats,
+		SectionTemplate: config.SectionTemplate,
+		Languages:       makeLanguages(config),
+		Related:         deref(config.Related),
+		Generators:      config.Generators,
+		Assets:          deref(config.Assets),
+		Images:          images,
+		Minify:          deref(config.Minify),
+		Manifest:        config.Manifest,
 	}
 }
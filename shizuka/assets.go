@@ -0,0 +1,155 @@
+package shizuka
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+)
+
+// AssetManifestPath is where the mapping from logical asset names to their fingerprinted paths is written.
+const AssetManifestPath = "/assets.json"
+
+// AssetOpts configures the processing of stylesheets and scripts in static/.
+type AssetOpts struct {
+	Minify      bool                `json:"minify"`      // whether to minify css and js files
+	Fingerprint bool                `json:"fingerprint"` // whether to add a hash of the content to each file name
+	Bundles     map[string][]string `json:"bundles"`     // files to concatenate, keyed by the bundle's path, e.g. "/bundle.js"
+}
+
+// asset is a processed stylesheet or script, ready to be written.
+type asset struct {
+	Path    string // the path the asset is written to, which may be fingerprinted
+	Content []byte
+}
+
+func (opts AssetOpts) enabled() bool {
+	return opts.Minify || opts.Fingerprint || len(opts.Bundles) > 0
+}
+
+// isProcessedAsset reports whether a static file is handled by the asset pipeline.
+func isProcessedAsset(relPath string) bool {
+	ext := path.Ext(relPath)
+	return ext == ".css" || ext == ".js"
+}
+
+// fingerprintPath inserts a short hash of content before the extension of relPath.
+func fingerprintPath(relPath string, content []byte) string {
+	sum := sha256.Sum256(content)
+	ext := path.Ext(relPath)
+	return strings.TrimSuffix(relPath, ext) + "." + hex.EncodeToString(sum[:])[:8] + ext
+}
+
+// processAsset minifies and fingerprints an asset according to opts.
+func (opts AssetOpts) processAsset(relPath string, content []byte) asset {
+	if opts.Minify {
+		switch path.Ext(relPath) {
+		case ".css":
+			content = minifyCSS(content)
+		case ".js":
+			content = minifyJS(content)
+		}
+	}
+
+	if opts.Fingerprint {
+		relPath = fingerprintPath(relPath, content)
+	}
+
+	return asset{Path: relPath, Content: content}
+}
+
+// indexAssets processes every stylesheet and script in static/, along with any bundles, and removes
+// them from the files to copy verbatim.
+func (pb *PageBuilder) indexAssets() error {
+	pb.assets = make(map[string]asset)
+
+	opts := pb.Opts.Assets
+	if !opts.enabled() {
+		return nil
+	}
+
+	sources := make(map[string][]byte)
+	remaining := make([]Location, 0, len(pb.static))
+	for _, location := range pb.static {
+		if !isProcessedAsset(location.RelPath) {
+			remaining = append(remaining, location)
+			continue
+		}
+
+		content, err := fs.ReadFile(pb.fsys, location.SrcPath)
+		if err != nil {
+			return fmt.Errorf("failed to read asset %s: %w", location.SrcPath, err)
+		}
+
+		sources[location.RelPath] = content
+		pb.assets[location.RelPath] = opts.processAsset(location.RelPath, content)
+	}
+	pb.static = remaining
+
+	for name, files := range opts.Bundles {
+		name = "/" + strings.TrimPrefix(name, "/")
+
+		bundle := make([]byte, 0)
+		for _, file := range files {
+			content, ok := sources["/"+strings.TrimPrefix(file, "/")]
+			if !ok {
+				return fmt.Errorf("bundle %s: %s is not a css or js file in static", name, file)
+			}
+
+			bundle = append(bundle, content...)
+			if len(content) > 0 && content[len(content)-1] != '\n' {
+				bundle = append(bundle, '\n')
+			}
+		}
+
+		pb.assets[name] = opts.processAsset(name, bundle)
+	}
+
+	return nil
+}
+
+// buildAssets writes every processed asset, along with a manifest mapping each logical name to the
+// path it was written to.
+func (pb *PageBuilder) buildAssets() error {
+	if !pb.Opts.Assets.enabled() {
+		return nil
+	}
+
+	manifest := make(map[string]string, len(pb.assets))
+	names := make([]string, 0, len(pb.assets))
+	for name := range pb.assets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		a := pb.assets[name]
+		manifest[name] = a.Path
+
+		if err := pb.writeFile(a.Path, a.Content); err != nil {
+			return fmt.Errorf("failed to write asset: %w", err)
+		}
+	}
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode asset manifest: %w", err)
+	}
+
+	return pb.writeFile(AssetManifestPath, content)
+}
+
+// assetPath resolves the logical name of an asset, such as "/styles.css", to the path it is
+// published at. Files outside the asset pipeline resolve to themselves.
+func (pb *PageBuilder) assetPath(name string) string {
+	name = "/" + strings.TrimPrefix(name, "/")
+	if a, ok := pb.assets[name]; ok {
+		return a.Path
+	}
+
+	return name
+}
@@ -2,19 +2,20 @@ package shizuka
 
 import (
 	"bytes"
+	"cmp"
 	"fmt"
-	"github.com/charmbracelet/log"
 	"github.com/yuin/goldmark"
 	gmext "github.com/yuin/goldmark/extension"
 	gmparse "github.com/yuin/goldmark/parser"
 	gmhtml "github.com/yuin/goldmark/renderer/html"
 	"html/template"
-	"io"
+	"io/fs"
 	"os"
 	"path"
-	"path/filepath"
 	"slices"
 	"strings"
+	"sync"
+	texttemplate "text/template"
 	"time"
 )
 
@@ -30,6 +31,7 @@ type Lite struct {
 	LiteData map[string]any
 
 	Path string
+	Lang string
 }
 
 type Page struct {
@@ -46,6 +48,17 @@ type Page struct {
 	Data     map[string]any
 	LiteData map[string]any
 
+	Taxonomies map[string][]string
+
+	Paginate       int
+	PaginatePath   string
+	SitemapInclude bool
+
+	Outputs []OutputFormat
+
+	Lang           string
+	TranslationKey string
+
 	Location Location
 	Content  template.HTML
 	Template string
@@ -60,6 +73,7 @@ func (p Page) Lite() Lite {
 		Tags:        p.Tags,
 		LiteData:    p.LiteData,
 		Path:        p.Location.RelPath,
+		Lang:        p.Lang,
 	}
 }
 
@@ -77,8 +91,34 @@ type PageData struct {
 	Data     map[string]any
 	LiteData map[string]any
 
-	Content template.HTML
-	PageMap map[string][]Lite
+	Content  template.HTML
+	PageMap  map[string][]Lite
+	SiteData map[string]any // the contents of the data directories of the site and its themes
+
+	Path      string // the path of the page relative to the site root
+	Permalink string // the absolute URL of the page
+
+	Parent    *Lite  // the index page of the section containing the page, if it has one
+	Ancestors []Lite // the pages above this one, from the root down to the parent
+	Children  []Lite // the pages in the section this page is the index of
+	Prev      *Lite  // the page listed before this one in its section (newer)
+	Next      *Lite  // the page listed after this one in its section (older)
+
+	Taxonomies map[string]*Taxonomy // every configured taxonomy in the page's language, by name
+	Taxonomy   *Taxonomy            // the taxonomy being listed, on taxonomy and term pages
+	Term       *Term                // the term being listed, on term pages
+
+	Paginator *Paginator // the current page of items, on paginated pages
+
+	OutputFormat string       // the name of the format being rendered
+	Outputs      []OutputLink // every format the page is rendered to
+
+	Lang         string // the language of the page
+	Translations []Lite // the same page in every other language
+
+	Related []Lite // the pages sharing the most tags, keywords and data with this one
+
+	Resources []Resource // the files in content/ which belong to this page
 }
 
 type BuildOpts struct {
@@ -92,60 +132,191 @@ type BuildOpts struct {
 	SiteTitle       string // global title for the site (used for RSS)
 	SiteDescription string // global description for the site (used for RSS)
 	SiteLang        string // global language for the site (used for RSS)
+
+	Taxonomies []string // frontmatter keys to group pages by, e.g. "tags" or "categories"
+
+	Themes []string // theme directories to fall back on for templates, static files and data, highest precedence first
+
+	Outputs       map[string][]string     // output formats for each section, keyed by section path
+	OutputFormats map[string]OutputFormat // custom output formats, added to DefaultOutputFormats
+
+	SectionTemplate string // the template for sections without an index.md, DefaultSectionTemplate if empty
+
+	Languages Languages // the languages the site is published in, if more than one
+
+	Related RelatedOpts // how to find related pages
+
+	Generators []Generator // pages to generate from data files
+
+	Assets AssetOpts // how to process stylesheets and scripts
+	Images ImageOpts // how to resize images
+
+	Minify MinifyOpts // which output files to minify
+
+	Jobs int // the number of pages to render at once, GOMAXPROCS if 0
+
+	Manifest bool // whether to write build-manifest.json, listing every file built, to the output
+
+	BuildTime time.Time // the time the site is built at, given as feeds' build date, the current time if zero
 }
 
 type PageBuilder struct {
-	src, dst string
+	src  fs.FS  // the site
+	fsys fs.FS  // the site layered over its themes
+	out  Output // where the site is written
+
+	dirs          []Location
+	content       []Location
+	static        []Location
+	templates     *template.Template
+	textTemplates *texttemplate.Template
+	data          map[string]any
+	dataFiles     map[string]string
+
+	templateFiles map[string]string
+	errors        []*RenderError
+	pageErrors    []*PageError // pages which failed to index
+
+	langTemplates     map[string]*template.Template
+	langTextTemplates map[string]*texttemplate.Template
+
+	pages      map[string]Page
+	pageMap    map[string][]Lite
+	taxonomies map[string]map[string]*Taxonomy // by language, then name
+	paginators map[string][]*Paginator
+
+	translations map[string][]Lite
+	related      map[string][]Lite
+	assets       map[string]asset
+	images       map[string]*responsiveImage
+	resources    map[string][]Resource
+	bundles      []bundleCopy
 
-	dirs      []Location
-	content   []Location
-	static    []Location
-	templates *template.Template
+	sitemap *Sitemap
+	feeds   map[string]*RSS
 
-	pages   map[string]Page
-	pageMap map[string][]Lite
+	minified  minifyStats
+	buildTime time.Time // Opts.BuildTime, or when the site was indexed
 
-	sitemap *Sitemap
-	rss     *RSS
+	plugins []Plugin
+
+	manifest      map[string]ManifestFile // every file written, keyed by its path in the output
+	warnings      []string
+	indexWarnings int // how many of the warnings were found while indexing, rather than building
+
+	// mu guards the state added to in parallel: errors, minified, manifest, warnings and parseCache
+	mu sync.Mutex
+
+	// kept between builds, so that Rebuild can tell what has changed
+	parseCache   map[string]cachedPage
+	templateInfo map[string]templateInfo
+	deps         map[string]map[string]bool
+	views        map[string]pageView
+	built        bool // whether the last build succeeded, so the destination is complete
 
 	Opts BuildOpts
 }
 
-func NewPageBuilder(src, dst string) *PageBuilder {
-	return &PageBuilder{
+// NewPageBuilder creates a page builder which reads the site from src and writes it to out. Paths in
+// src are as laid out in a site directory, e.g. content/index.md and templates/page.tmpl.
+func NewPageBuilder(src fs.FS, out Output) *PageBuilder {
+	pb := &PageBuilder{
 		src: src,
-		dst: dst,
+		out: out,
 	}
+
+	if out, ok := out.(warner); ok {
+		out.setWarn(pb.warn)
+	}
+
+	return pb
 }
 
 func (pb *PageBuilder) IndexPage(md goldmark.Markdown, file Location) {
-	fileContent, err := os.ReadFile(file.SrcPath)
+	pb.addParsedPage(pb.parsePage(md, file))
+}
+
+// parsedPage is a content file which has been read and converted, but not yet added to the site.
+type parsedPage struct {
+	file        Location
+	frontmatter *Frontmatter
+	content     []byte
+	warn        error // a problem which didn't stop the page from being parsed
+	err         error // a problem which did
+}
+
+// parsePage reads a content file and converts its markdown. It only reads from the page builder, so
+// can be called for many files at once.
+func (pb *PageBuilder) parsePage(md goldmark.Markdown, file Location) parsedPage {
+	parsed := parsedPage{file: file}
+
+	fileContent, err := fs.ReadFile(pb.src, file.SrcPath)
 	if err != nil {
-		log.Error("failed to read file", "file", file.SrcPath, "error", err)
-		return
+		parsed.err = fmt.Errorf("failed to read file: %w", err)
+		return parsed
 	}
 
 	frontmatter, fileContent, err := extractFrontmatter(fileContent)
 	if err != nil && fileContent == nil {
-		log.Error("failed to parse file", "file", file, "error", err)
-		return
+		parsed.err = fmt.Errorf("failed to parse file: %w", err)
+		return parsed
 	} else if err != nil {
-		log.Warn("failed to parse frontmatter, ignoring...", "file", file, "error", err)
+		parsed.warn = fmt.Errorf("failed to parse frontmatter, ignoring...: %w", err)
+	}
+
+	if err := pb.afterFrontmatter(file, frontmatter); err != nil {
+		parsed.err = err
+		return parsed
 	}
 
-	htmlBuf := bytes.NewBuffer(nil)
-	err = md.Convert(fileContent, htmlBuf)
+	html, err := pb.convertMarkdown(md, file, fileContent)
 	if err != nil {
-		log.Error("Failed to build file content", "file", file.SrcPath, "error", err)
+		parsed.err = fmt.Errorf("failed to build file content: %w", err)
+		return parsed
+	}
+
+	parsed.frontmatter = frontmatter
+	parsed.content = html
+	return parsed
+}
+
+// addParsedPage reports any problems parsing a page, and adds it to the site if it could be parsed.
+// Pages which couldn't be parsed are recorded in pb.pageErrors, failing the index.
+func (pb *PageBuilder) addParsedPage(parsed parsedPage) {
+	if parsed.err != nil {
+		pb.pageErrors = append(pb.pageErrors, &PageError{Source: parsed.file.SrcPath, Err: parsed.err})
 		return
+	} else if parsed.warn != nil {
+		pb.warn("problem indexing page", "file", parsed.file.SrcPath, "error", parsed.warn)
 	}
 
-	fileContent = htmlBuf.Bytes()
+	pb.addPage(parsed.frontmatter, parsed.file, parsed.content)
+}
 
+// addPage adds a page with the given frontmatter and rendered content to the site.
+func (pb *PageBuilder) addPage(frontmatter *Frontmatter, file Location, fileContent []byte) {
 	if pb.Opts.Dev {
 		fileContent = append(fileContent, []byte(pb.Opts.DevScript)...)
 	}
 
+	outputs, err := pb.outputFormats(file.RelPath, frontmatter.Outputs)
+	if err != nil {
+		pb.warn("failed to find output formats, using html", "file", file.SrcPath, "error", err)
+		outputs = []OutputFormat{HTMLFormat}
+	}
+
+	// the not found page is served in place of missing files, so it only makes sense as html, and
+	// shouldn't be advertised as a page of the site
+	notFound := isNotFound(file.RelPath)
+	if notFound {
+		outputs = []OutputFormat{HTMLFormat}
+	}
+
+	taxonomies := make(map[string][]string)
+	for _, taxonomy := range pb.Opts.Taxonomies {
+		taxonomies[taxonomy] = frontmatter.Terms(taxonomy)
+	}
+
 	pb.pages[file.RelPath] = Page{
 		Title:           frontmatter.Title,
 		Description:     frontmatter.Description,
@@ -157,6 +328,13 @@ func (pb *PageBuilder) IndexPage(md goldmark.Markdown, file Location) {
 		MetaKeywords:    frontmatter.MetaKeywords,
 		Data:            frontmatter.Data,
 		LiteData:        frontmatter.LiteData,
+		Taxonomies:      taxonomies,
+		Paginate:        frontmatter.Paginate,
+		PaginatePath:    frontmatter.PaginatePath,
+		SitemapInclude:  frontmatter.SitemapInclude,
+		Outputs:         outputs,
+		Lang:            file.Lang,
+		TranslationKey:  pb.Opts.Languages.TranslationKey(file.Lang, file.RelPath),
 		Location:        file,
 		Content:         template.HTML(fileContent),
 		Template:        frontmatter.Template,
@@ -164,6 +342,10 @@ func (pb *PageBuilder) IndexPage(md goldmark.Markdown, file Location) {
 
 	pb.pageMap[file.RelPath] = make([]Lite, 0)
 
+	if notFound {
+		return
+	}
+
 	if pb.Opts.UseSitemap && frontmatter.SitemapInclude {
 		pb.sitemap.AddURL(
 			file.RelPath,
@@ -174,7 +356,7 @@ func (pb *PageBuilder) IndexPage(md goldmark.Markdown, file Location) {
 	}
 
 	if pb.Opts.UseRss && frontmatter.RSSInclude {
-		pb.rss.AddItem(
+		pb.feed(file.Lang).AddItem(
 			file.RelPath,
 			frontmatter.Date,
 			frontmatter.Title,
@@ -183,15 +365,71 @@ func (pb *PageBuilder) IndexPage(md goldmark.Markdown, file Location) {
 	}
 }
 
-func (pb *PageBuilder) Index() (err error) {
-	dirs, content, static, templates, err := index(pb.src, pb.dst)
-	if err != nil {
-		return fmt.Errorf("NewPageBuilder: failed to index content: %w", err)
+func (pb *PageBuilder) Index() error {
+	return pb.index(indexKeep{})
+}
+
+// indexKeep is what an index can keep from the last one, as Rebuild knows it hasn't changed.
+type indexKeep struct {
+	files     bool // the lists of content and static files, the data files and the processed assets
+	templates bool // the parsed templates
+}
+
+// index indexes the site, keeping what keep allows from the last index. Content files are always
+// parsed again, though the parse cache means only those which have changed are converted.
+func (pb *PageBuilder) index(keep indexKeep) error {
+	pb.buildTime = pb.Opts.BuildTime
+	if pb.buildTime.IsZero() {
+		pb.buildTime = time.Now()
+	}
+
+	// themes are directories, layered under the site in order of precedence
+	layers := []fs.FS{pb.src}
+	for _, theme := range pb.Opts.Themes {
+		layers = append(layers, os.DirFS(theme))
+	}
+	pb.fsys = layeredFS{layers: layers}
+
+	if !keep.files || pb.content == nil {
+		idx, err := index(pb.fsys, pb.src, pb.Opts.Languages)
+		if err != nil {
+			return fmt.Errorf("NewPageBuilder: failed to index content: %w", err)
+		}
+
+		pb.dirs = idx.dirs
+		pb.content = idx.content
+		pb.static = idx.static
+		pb.data = idx.data
+		pb.dataFiles = idx.dataFiles
+		keep.files = false
 	}
 
-	pb.dirs = dirs
-	pb.static = static
-	pb.templates = templates
+	if !keep.templates || pb.templates == nil {
+		templates, textTemplates, tmplFiles, err := indexTemplates(pb.fsys, pb.funcMap())
+		if err != nil {
+			return fmt.Errorf("NewPageBuilder: failed to parse templates: %w", err)
+		}
+
+		pb.templates = templates
+		pb.textTemplates = textTemplates
+		pb.templateFiles = tmplFiles
+
+		pb.indexTemplateInfo()
+
+		if err := pb.localiseTemplates(); err != nil {
+			return fmt.Errorf("NewPageBuilder: %w", err)
+		}
+	}
+
+	if !keep.files {
+		if err := pb.indexAssets(); err != nil {
+			return fmt.Errorf("NewPageBuilder: failed to index assets: %w", err)
+		}
+
+		if err := pb.indexImages(); err != nil {
+			return fmt.Errorf("NewPageBuilder: failed to index images: %w", err)
+		}
+	}
 
 	md := goldmark.New(
 		goldmark.WithRendererOptions(
@@ -207,16 +445,25 @@ func (pb *PageBuilder) Index() (err error) {
 		goldmark.WithParserOptions(
 			gmparse.WithAutoHeadingID(),
 		),
+		goldmark.WithExtensions(pb.markdownExtensions()...),
 	)
 
+	if pb.parseCache == nil {
+		pb.parseCache = make(map[string]cachedPage)
+	}
+
 	pb.pages = make(map[string]Page)
 	pb.pageMap = make(map[string][]Lite)
+	pb.warnings = nil
+	pb.indexWarnings = 0
+	pb.pageErrors = nil
 
 	pb.sitemap = NewSitemap(pb.Opts.BaseURL)
-	pb.rss = NewRSS(pb.Opts.BaseURL, pb.Opts.SiteTitle, pb.Opts.SiteDescription, pb.Opts.SiteLang)
+	pb.feeds = make(map[string]*RSS)
 
-	for _, file := range content {
-		if filepath.Ext(file.SrcPath) != ".md" {
+	files := make([]Location, 0, len(pb.content))
+	for _, file := range pb.content {
+		if path.Ext(file.SrcPath) != ".md" {
 			continue
 		}
 
@@ -225,35 +472,108 @@ func (pb *PageBuilder) Index() (err error) {
 			continue
 		}
 
-		pb.IndexPage(md, file)
+		files = append(files, file)
 	}
 
+	// markdown is converted in parallel, then pages are added in order so the site comes out the same
+	// however the conversions are scheduled
+	parsed := make([]parsedPage, len(files))
+	_ = pb.parallel(len(files), func(i int) error {
+		if cached, ok := pb.cachedParse(files[i]); ok {
+			parsed[i] = cached
+			return nil
+		}
+
+		info, err := fs.Stat(pb.src, files[i].SrcPath)
+		parsed[i] = pb.parsePage(md, files[i])
+		if err == nil {
+			pb.cacheParse(parsed[i], info)
+		}
+		return nil
+	})
+
+	for _, page := range parsed {
+		pb.addParsedPage(page)
+	}
+
+	pb.indexResources()
+	pb.indexGenerators(md)
+	pb.indexSections()
+	pb.indexTranslations()
+
 	for s, page := range pb.pages {
-		if s == "/" {
+		parent := pb.parentOf(page.Location.RelPath)
+		if parent == "" {
 			continue // root does not have a parent
 		}
 
-		parent := filepath.Dir(page.Location.RelPath)
+		if isNotFound(s) {
+			continue // the not found page isn't part of any section
+		}
+
 		pb.pageMap[parent] = append(pb.pageMap[parent], page.Lite())
 	}
 
 	for _, pages := range pb.pageMap {
-		slices.SortFunc(pages, func(a, b Lite) int {
-			at, _ := time.Parse(dateLayout, a.Date)
-			bt, _ := time.Parse(dateLayout, b.Date)
-
-			if at.After(bt) {
-				return -1
-			} else {
-				return +1
-			}
-		})
+		sortByDate(pages)
 	}
 
+	pb.indexTaxonomies()
+	pb.indexRelated()
+	pb.indexPagination()
+	pb.indexDeps()
+
+	pb.indexWarnings = len(pb.warnings)
+
+	return pb.indexErrors()
+}
+
+// sortByDate orders pages from newest to oldest, and pages with the same date by path.
+func sortByDate(pages []Lite) {
+	slices.SortFunc(pages, func(a, b Lite) int {
+		at, _ := time.Parse(dateLayout, a.Date)
+		bt, _ := time.Parse(dateLayout, b.Date)
+
+		return cmp.Or(bt.Compare(at), strings.Compare(a.Path, b.Path))
+	})
+}
+
+// Build writes the whole indexed site to the output, replacing what was there. The output is only
+// committed once the whole build has succeeded, so a failed build leaves the previous output untouched.
+// A site with pages which failed to index isn't built at all.
+func (pb *PageBuilder) Build() error {
+	if err := pb.indexErrors(); err != nil {
+		return err
+	}
+
+	// the output can warn as it begins, so the last build's warnings are cleared first
+	pb.warnings = pb.warnings[:pb.indexWarnings]
+
+	if err := pb.out.Begin(true); err != nil {
+		_ = pb.out.Abort()
+		return fmt.Errorf("Build: %w", err)
+	}
+
+	pb.built = false
+
+	if err := pb.build(); err != nil {
+		_ = pb.out.Abort()
+		return err
+	}
+
+	if err := pb.out.Commit(); err != nil {
+		return fmt.Errorf("Build: failed to write output: %w", err)
+	}
+
+	pb.built = true
 	return nil
 }
 
-func (pb *PageBuilder) Build() (err error) {
+// build writes the whole site to the output.
+func (pb *PageBuilder) build() error {
+	pb.minified = minifyStats{}
+	pb.manifest = make(map[string]ManifestFile)
+
 	if err := pb.replicateDirs(); err != nil {
 		return fmt.Errorf("Build: failed to replicate directories: %w", err)
 	}
@@ -262,38 +582,177 @@ func (pb *PageBuilder) Build() (err error) {
 		return fmt.Errorf("Build: failed to replicate static content: %w", err)
 	}
 
-	for _, page := range pb.pages {
-		temp := pb.templates.Lookup(page.Template)
-		if temp == nil {
-			log.Warn("failed to find template, skipping", "file", page.Location.SrcPath, "template", page.Template)
-			continue
-		}
+	if err := pb.replicateContent(); err != nil {
+		return fmt.Errorf("Build: failed to replicate page resources: %w", err)
+	}
 
-		file, err := os.Create(page.Location.DstPath)
-		if err != nil {
-			return fmt.Errorf("Build: failed to create file %s: %w", page.Location.DstPath, err)
+	if err := pb.buildAssets(); err != nil {
+		return fmt.Errorf("Build: failed to build assets: %w", err)
+	}
+
+	if err := pb.buildImages(); err != nil {
+		return fmt.Errorf("Build: failed to build images: %w", err)
+	}
+
+	pb.errors = make([]*RenderError, 0)
+
+	paths := make([]string, 0, len(pb.pages))
+	for relPath := range pb.pages {
+		paths = append(paths, relPath)
+	}
+	slices.Sort(paths)
+
+	err := pb.parallel(len(paths), func(i int) error {
+		return pb.buildPage(pb.pages[paths[i]])
+	})
+	if err != nil {
+		return fmt.Errorf("Build: %w", err)
+	}
+
+	if err := pb.buildShared(); err != nil {
+		return fmt.Errorf("Build: %w", err)
+	}
+
+	pb.logMinified()
+
+	if err := pb.renderErrors(); err != nil {
+		return err
+	}
+
+	if err := pb.finishBuild(); err != nil {
+		return fmt.Errorf("Build: %w", err)
+	}
+
+	return nil
+}
+
+// buildShared writes the pages built from the whole site rather than any one content file: the
+// taxonomy pages, sitemap and feeds.
+func (pb *PageBuilder) buildShared() error {
+	if err := pb.buildTaxonomies(); err != nil {
+		return fmt.Errorf("failed to build taxonomies: %w", err)
+	}
+
+	sitemap, err := pb.sitemap.Encode()
+	if err != nil {
+		return fmt.Errorf("failed to build sitemap: %w", err)
+	}
+
+	if err := pb.writeFile("/sitemap.xml", sitemap); err != nil {
+		return fmt.Errorf("failed to write sitemap: %w", err)
+	}
+
+	if pb.Opts.UseRss {
+		if _, ok := pb.feeds[pb.Opts.Languages.Default]; !ok {
+			pb.feed(pb.Opts.Languages.Default) // always write a feed for the default language
 		}
 
-		if err := temp.Execute(file, pb.pageData(page)); err != nil {
-			_ = file.Close()
-			return fmt.Errorf("Build: failed to render file %s: %w", page.Location.RelPath, err)
+		for lang, rss := range pb.feeds {
+			feedPath := path.Join("/", pb.Opts.Languages.Prefix(lang), "rss.xml")
+			feed, err := rss.Encode()
+			if err != nil {
+				return fmt.Errorf("failed to build rss: %w", err)
+			}
+
+			if err := pb.writeFile(feedPath, feed); err != nil {
+				return fmt.Errorf("failed to write rss: %w", err)
+			}
 		}
+	}
 
-		_ = file.Close()
+	return nil
+}
+
+// finishBuild runs the AfterBuild hooks and writes the build manifest, once every page has been
+// rendered without errors.
+func (pb *PageBuilder) finishBuild() error {
+	if err := pb.afterBuild(); err != nil {
+		return err
 	}
 
-	if err := pb.sitemap.Build(path.Join(pb.dst, "sitemap.xml")); err != nil {
-		return fmt.Errorf("Build: failed to build sitemap: %w", err)
+	return pb.writeManifest()
+}
+
+// buildPage renders a page in each of its output formats.
+func (pb *PageBuilder) buildPage(page Page) error {
+	if pb.paginators[page.Location.RelPath] != nil {
+		return pb.buildPagination(page)
 	}
 
-	if err := pb.rss.Build(path.Join(pb.dst, "rss.xml")); err != nil {
-		return fmt.Errorf("Build: failed to build rss: %w", err)
+	for _, format := range page.Outputs {
+		data := pb.pageData(page)
+		data.OutputFormat = format.Name
+
+		name := formatTemplate(page.Template, format)
+		dstPath := formatDstPath(page.Location.DstPath, format)
+
+		if err := pb.renderPage(name, page.Location.SrcPath, dstPath, data); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// renderPage executes the template called name with data and writes the result to dstPath.
+// Templates which are missing or fail to execute are recorded in pb.errors rather than returned, so
+// that one broken page doesn't hide the problems with the rest of the site.
+func (pb *PageBuilder) renderPage(name, source, dstPath string, data PageData) error {
+	temp := pb.lookupTemplate(data.Lang, name)
+	if temp == nil {
+		pb.addRenderError(&RenderError{
+			Path:     data.Path,
+			Source:   source,
+			Template: name,
+			Err:      ErrorTemplateNotFound,
+		})
+		return nil
+	}
+
+	buf := bytes.NewBuffer(nil)
+	start := time.Now()
+	if err := temp.Execute(buf, data); err != nil {
+		pb.addRenderError(pb.newRenderError(data.Path, source, name, err))
+		return nil
+	}
+	renderTime := time.Since(start)
+
+	content, err := pb.afterRender(dstPath, data, buf.Bytes())
+	if err != nil {
+		pb.addRenderError(&RenderError{
+			Path:     data.Path,
+			Source:   source,
+			Template: name,
+			Err:      err,
+		})
+		return nil
+	}
+
+	if pb.Opts.Minify.HTML && path.Ext(dstPath) == ".html" {
+		content = pb.minify(content)
+	}
+
+	return pb.writeOutput(ManifestFile{
+		Path:       dstPath,
+		Source:     source,
+		Template:   name,
+		RenderTime: renderTime,
+	}, content)
+}
+
+// devContent returns the content generated pages carry, which is just the dev script when in dev mode.
+func (pb *PageBuilder) devContent() template.HTML {
+	if pb.Opts.Dev {
+		return template.HTML(pb.Opts.DevScript)
+	}
+
+	return ""
+}
+
 func (pb *PageBuilder) pageData(page Page) PageData {
+	relPath := page.Location.RelPath
+	prev, next := pb.siblings(relPath)
+
 	return PageData{
 		Title:           page.Title,
 		Description:     page.Description,
@@ -307,6 +766,21 @@ func (pb *PageBuilder) pageData(page Page) PageData {
 		LiteData:        page.LiteData,
 		Content:         page.Content,
 		PageMap:         pb.pageMap,
+		SiteData:        pb.data,
+		Path:            relPath,
+		Permalink:       permalink(pb.Opts.BaseURL, relPath),
+		Parent:          pb.lite(pb.parentOf(relPath)),
+		Ancestors:       pb.ancestors(relPath),
+		Children:        pb.pageMap[relPath],
+		Prev:            prev,
+		Next:            next,
+		Taxonomies:      pb.taxonomies[page.Lang],
+		OutputFormat:    HTMLFormat.Name,
+		Outputs:         pb.outputLinks(relPath, page.Outputs),
+		Lang:            page.Lang,
+		Translations:    pb.pageTranslations(page),
+		Related:         pb.related[relPath],
+		Resources:       pb.resources[relPath],
 	}
 }
 
@@ -317,44 +791,43 @@ func (pb *PageBuilder) replicateStatic() error {
 			continue
 		}
 
-		// Open the source file
-		srcFile, err := os.Open(location.SrcPath)
-		if err != nil {
-			return fmt.Errorf("failed to open source file %s: %w", location.SrcPath, err)
+		if err := pb.replicateStaticFile(location); err != nil {
+			return err
 		}
+	}
 
-		// Create the destination file
-		dstFile, err := os.Create(location.DstPath)
-		if err != nil {
-			_ = srcFile.Close()
-			return fmt.Errorf("failed to create destination file %s: %w", location.DstPath, err)
-		}
+	return nil
+}
 
-		// Copy the content from source to destination
-		if _, err := io.Copy(dstFile, srcFile); err != nil {
-			_ = srcFile.Close()
-			_ = dstFile.Close()
-			return fmt.Errorf("failed to copy content from %s to %s: %w", location.SrcPath, location.DstPath, err)
-		}
+// replicateStaticFile copies a static file to the destination, minifying it if configured to.
+func (pb *PageBuilder) replicateStaticFile(location Location) error {
+	if pb.Opts.Minify.Static && isMinifiedStatic(location.SrcPath) {
+		return pb.minifyStatic(location)
+	}
 
-		_ = srcFile.Close()
-		_ = dstFile.Close()
+	return pb.copyFile(location.SrcPath, location.DstPath)
+}
+
+// minifyStatic writes a minified copy of a static file.
+func (pb *PageBuilder) minifyStatic(location Location) error {
+	content, err := fs.ReadFile(pb.fsys, location.SrcPath)
+	if err != nil {
+		return fmt.Errorf("failed to read static file %s: %w", location.SrcPath, err)
 	}
 
-	return nil
+	return pb.writeOutput(ManifestFile{Path: location.DstPath, Source: location.SrcPath}, pb.minify(content))
 }
 
+// replicateDirs creates every directory of the site, so that empty static directories are kept, where
+// the output can hold empty directories.
 func (pb *PageBuilder) replicateDirs() error {
-	// Remove any existing destination directory
-	if err := os.RemoveAll(pb.dst); err != nil {
-		return fmt.Errorf("build: failed to remove %s: %w", pb.dst, err)
-	}
-	if err := os.MkdirAll(pb.dst, os.ModePerm); err != nil {
-		return fmt.Errorf("build: failed to create directory %s: %w", pb.dst, err)
+	out, ok := pb.out.(dirMaker)
+	if !ok {
+		return nil
 	}
 
 	for _, dir := range pb.dirs {
-		if err := os.MkdirAll(dir.DstPath, os.ModePerm); err != nil {
+		if err := out.MkdirAll(outputName(dir.DstPath)); err != nil {
 			return fmt.Errorf("build: failed to replicate directory %s: %w", dir.DstPath, err)
 		}
 	}
@@ -0,0 +1,93 @@
+package shizuka
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+)
+
+// indexData loads the YAML and JSON files in the data directory of fsys.
+// Each file is keyed by its path without the extension, so data/authors/jane.yaml is found at
+// ["authors"]["jane"]. Files which would be found at the same key, such as foo.yaml and foo.json, or
+// authors.yaml and authors/jane.yaml, are an error. It also returns the path of the file each key
+// was loaded from.
+func indexData(fsys fs.FS) (map[string]any, map[string]string, error) {
+	const dataRoot = "data"
+
+	srcDataFiles, _, err := walk(fsys, dataRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	files := make(map[string]string)
+	for _, srcPath := range srcDataFiles {
+		ext := path.Ext(srcPath)
+		if ext != ".yaml" && ext != ".yml" && ext != ".json" {
+			continue
+		}
+
+		key := strings.TrimPrefix(strings.TrimSuffix(srcPath, ext), dataRoot+"/")
+		if other, ok := files[key]; ok {
+			return nil, nil, fmt.Errorf("%w: %s and %s", ErrorDataConflict, other, srcPath)
+		}
+		files[key] = srcPath
+	}
+
+	keys := slices.Sorted(maps.Keys(files))
+	for _, key := range keys {
+		for parent := path.Dir(key); parent != "."; parent = path.Dir(parent) {
+			if other, ok := files[parent]; ok {
+				return nil, nil, fmt.Errorf("%w: %s and %s", ErrorDataConflict, other, files[key])
+			}
+		}
+	}
+
+	data := make(map[string]any)
+	for _, key := range keys {
+		srcPath := files[key]
+		value, err := loadDataFile(fsys, srcPath)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		parts := strings.Split(key, "/")
+		parent := data
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := parent[part].(map[string]any)
+			if !ok {
+				child = make(map[string]any)
+				parent[part] = child
+			}
+			parent = child
+		}
+
+		parent[parts[len(parts)-1]] = value
+	}
+
+	return data, files, nil
+}
+
+// loadDataFile decodes a single YAML or JSON data file.
+func loadDataFile(fsys fs.FS, srcPath string) (any, error) {
+	content, err := fs.ReadFile(fsys, srcPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data file %s: %w", srcPath, err)
+	}
+
+	var value any
+	if path.Ext(srcPath) == ".json" {
+		err = json.Unmarshal(content, &value)
+	} else {
+		err = yaml.Unmarshal(content, &value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse data file %s: %w", srcPath, err)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,42 @@
+package shizuka
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+func TestIndexData(t *testing.T) {
+	data, files, err := indexData(fstest.MapFS{
+		"data/site.yaml":         {Data: []byte("title: Site")},
+		"data/authors/jane.json": {Data: []byte(`{"name": "Jane"}`)},
+	})
+	if err != nil {
+		t.Fatalf("indexData: %v", err)
+	}
+
+	authors, _ := data["authors"].(map[string]any)
+	jane, _ := authors["jane"].(map[string]any)
+	if jane["name"] != "Jane" {
+		t.Errorf("authors.jane = %v, want name Jane", authors["jane"])
+	}
+	if files["authors/jane"] != "data/authors/jane.json" {
+		t.Errorf("authors/jane loaded from %q, want data/authors/jane.json", files["authors/jane"])
+	}
+
+	conflicts := []fstest.MapFS{
+		{
+			"data/foo.yaml": {Data: []byte("a: 1")},
+			"data/foo.json": {Data: []byte(`{"a": 2}`)},
+		},
+		{
+			"data/authors.yaml":      {Data: []byte("a: 1")},
+			"data/authors/jane.yaml": {Data: []byte("a: 2")},
+		},
+	}
+	for _, fsys := range conflicts {
+		if _, _, err := indexData(fsys); !errors.Is(err, ErrorDataConflict) {
+			t.Errorf("indexData = %v, want %v", err, ErrorDataConflict)
+		}
+	}
+}
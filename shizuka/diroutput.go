@@ -0,0 +1,500 @@
+package shizuka
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/charmbracelet/log"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// OutputMarker is written to the root of every build, marking the directory as shizuka's to replace.
+const OutputMarker = ".shizuka_output"
+
+// DirOutput writes a site to a directory. A full build is written to a staging directory next to it,
+// which replaces the directory only once the build is committed, so a failed build leaves the
+// previous output untouched. The directory is replaced by moving it aside and the staging directory
+// into its place, so for a moment between the two it doesn't exist; to serve the directory while
+// building, set InPlace. While writing, it holds a lock file next to the directory so that two builds
+// never write to it at once.
+type DirOutput struct {
+	Dir string // the directory to write to
+
+	Root             string   // the project directory, which Dir must be inside, the working directory if empty
+	Src              string   // the source directory, which Dir mustn't contain, if building from a directory
+	AllowExternalDst bool     // allow Dir to be outside of the project directory
+	Keep             []string // paths in Dir to carry over between builds, e.g. ".git" or "CNAME"
+	Clean            bool     // write every file afresh, rather than linking files unchanged since the last build
+	InPlace          bool     // write full builds straight into Dir, removing leftover files on commit, so it never goes missing
+
+	staging string   // where files are being written, which is Dir itself when writing in place
+	kept    []string // the paths in Keep which are within Dir, as local paths
+	unlock  func()
+	warn    func(msg string, keyvals ...any)
+
+	mu      sync.Mutex
+	written map[string]bool // the files and directories written by a full build in place, to keep on commit
+}
+
+func NewDirOutput(dir string) *DirOutput {
+	return &DirOutput{Dir: dir}
+}
+
+// within reports whether path is dir or somewhere inside it.
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolvePath returns the absolute form of p, following symlinks if it exists.
+func resolvePath(p string) (string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved, nil
+	}
+
+	return abs, nil
+}
+
+// check makes sure the directory is safe to replace, as everything in it not listed in Keep is lost.
+// It must be inside the project (unless AllowExternalDst is set) without being the project itself,
+// mustn't contain the source, and if it already has files in it they must be the output of an
+// earlier build.
+func (d *DirOutput) check() error {
+	root := d.Root
+	if root == "" {
+		root = "."
+	}
+
+	root, err := resolvePath(root)
+	if err != nil {
+		return fmt.Errorf("failed to find project directory: %w", err)
+	}
+
+	dst, err := resolvePath(d.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to find destination %s: %w", d.Dir, err)
+	}
+
+	switch {
+	case within(dst, root):
+		return fmt.Errorf("%w: %s is the project directory or contains it", ErrorUnsafeDestination, d.Dir)
+	case !within(root, dst) && !d.AllowExternalDst:
+		return fmt.Errorf("%w: %s is outside of the project directory, set allow_external_dst to build there", ErrorUnsafeDestination, d.Dir)
+	}
+
+	if d.Src != "" {
+		src, err := resolvePath(d.Src)
+		if err != nil {
+			return fmt.Errorf("failed to find source %s: %w", d.Src, err)
+		}
+
+		if within(dst, src) {
+			return fmt.Errorf("%w: %s is the source directory or contains it", ErrorUnsafeDestination, d.Dir)
+		}
+	}
+
+	// a build which couldn't carry every kept path over leaves the previous output beside the
+	// directory, which mustn't be lost to the next build
+	if old := siblingPath(d.Dir, "old"); exists(old) {
+		return fmt.Errorf("%w: %s holds the previous output, which a build failed to carry kept paths over from; move anything you need out of it and delete it",
+			ErrorUnsafeDestination, old)
+	}
+
+	entries, err := os.ReadDir(dst)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && len(entries) == 0) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("%w: failed to read %s: %w", ErrorUnsafeDestination, d.Dir, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dst, OutputMarker)); err != nil {
+		return fmt.Errorf("%w: %s has files in it but no %s marker, so wasn't built by shizuka; move or delete it to build there",
+			ErrorUnsafeDestination, d.Dir, OutputMarker)
+	}
+
+	return nil
+}
+
+// exists reports whether anything is at p, without following symlinks.
+func exists(p string) bool {
+	_, err := os.Lstat(p)
+	return err == nil
+}
+
+// siblingPath returns a hidden path next to dir, e.g. ".dist.staging" for "dist".
+func siblingPath(dir, suffix string) string {
+	dir = filepath.Clean(dir)
+	return filepath.Join(filepath.Dir(dir), "."+filepath.Base(dir)+"."+suffix)
+}
+
+// lock takes the advisory lock on the directory. The lock is a file next to the directory holding the
+// id of the process which owns it.
+func (d *DirOutput) lock() error {
+	lockPath := siblingPath(d.Dir, "lock")
+	if err := os.MkdirAll(filepath.Dir(lockPath), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", lockPath, err)
+	}
+
+	file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		owner, _ := os.ReadFile(lockPath)
+		pid, err := strconv.Atoi(strings.TrimSpace(string(owner)))
+		if err != nil || processAlive(pid) {
+			return fmt.Errorf("%w: %s is held by process %s, remove it if no other build is running",
+				ErrorBuildLocked, lockPath, strings.TrimSpace(string(owner)))
+		}
+
+		// the build holding the lock was killed before it could release it
+		d.warning("removing stale lock file", "path", lockPath, "pid", pid)
+		if err := os.Remove(lockPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove stale lock file %s: %w", lockPath, err)
+		}
+		file, err = os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("%w: %s was taken by another build", ErrorBuildLocked, lockPath)
+		} else if err != nil {
+			return fmt.Errorf("failed to create lock file %s: %w", lockPath, err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to create lock file %s: %w", lockPath, err)
+	}
+
+	_, err = fmt.Fprintf(file, "%d\n", os.Getpid())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(lockPath)
+		return fmt.Errorf("failed to write lock file %s: %w", lockPath, err)
+	}
+
+	d.unlock = func() {
+		_ = os.Remove(lockPath)
+	}
+
+	return nil
+}
+
+// processAlive reports whether the process with the given id is still running.
+func processAlive(pid int) bool {
+	if pid <= 0 || pid == os.Getpid() {
+		return true
+	}
+
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false // on windows, finding a process fails once it has exited
+	}
+
+	if runtime.GOOS == "windows" {
+		return true
+	}
+
+	// signal 0 checks the process exists without disturbing it
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, fs.ErrPermission)
+}
+
+// setWarn makes the directory report problems which don't stop the build through warn, rather than
+// only logging them.
+func (d *DirOutput) setWarn(warn func(msg string, keyvals ...any)) {
+	d.warn = warn
+}
+
+// warning reports a problem which doesn't stop the build.
+func (d *DirOutput) warning(msg string, keyvals ...any) {
+	if d.warn != nil {
+		d.warn(msg, keyvals...)
+		return
+	}
+
+	log.Warn(msg, keyvals...)
+}
+
+// release gives up the lock, if it is held.
+func (d *DirOutput) release() {
+	if d.unlock != nil {
+		d.unlock()
+		d.unlock = nil
+	}
+}
+
+// Begin checks the directory is safe to write to and takes the lock. A full build is staged in an
+// empty directory next to it, removing anything left behind by a build which failed. If Begin fails
+// the lock isn't held, and Abort does nothing.
+func (d *DirOutput) Begin(replace bool) (err error) {
+	d.staging = ""
+	d.written = nil
+
+	if err := d.check(); err != nil {
+		return err
+	}
+
+	if err := d.lock(); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			d.release()
+			d.staging = ""
+		}
+	}()
+
+	if !replace {
+		d.staging = d.Dir
+		return nil
+	}
+
+	d.kept = d.keepPaths()
+
+	if d.InPlace {
+		d.staging = d.Dir
+		d.written = make(map[string]bool)
+	} else {
+		d.staging = siblingPath(d.Dir, "staging")
+
+		if err := os.RemoveAll(d.staging); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", d.staging, err)
+		}
+
+		if err := os.MkdirAll(d.staging, os.ModePerm); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", d.staging, err)
+		}
+	}
+
+	return d.WriteFile(OutputMarker, []byte("This directory is replaced by every shizuka build.\n"))
+}
+
+// record notes that name was written by a full build in place, along with the directories it's in.
+func (d *DirOutput) record(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.written == nil {
+		return
+	}
+
+	for name = path.Clean(strings.TrimPrefix(name, "/")); name != "."; name = path.Dir(name) {
+		d.written[name] = true
+	}
+}
+
+// MkdirAll creates the directory name in the output, along with any parents.
+func (d *DirOutput) MkdirAll(name string) error {
+	d.record(name)
+
+	dirPath := filepath.Join(d.staging, filepath.FromSlash(name))
+	if err := os.MkdirAll(dirPath, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", dirPath, err)
+	}
+
+	return nil
+}
+
+// WriteFile writes content to name, creating the directory it's in if needed. Unless building clean,
+// a file which is unchanged from the current output is hard linked from it rather than written, so
+// that it keeps its modification time.
+func (d *DirOutput) WriteFile(name string, content []byte) error {
+	d.record(name)
+
+	dstPath := filepath.Join(d.Dir, filepath.FromSlash(name))
+	stagedPath := filepath.Join(d.staging, filepath.FromSlash(name))
+
+	var unchanged fs.FileInfo
+	if !d.Clean {
+		unchanged = sameContent(dstPath, content)
+	}
+
+	// when writing in place there's nothing to do for an unchanged file
+	if unchanged != nil && stagedPath == dstPath {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(stagedPath), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", stagedPath, err)
+	}
+
+	// the staged file may be a link to the current output, so must never be written through
+	if err := os.Remove(stagedPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to replace file %s: %w", stagedPath, err)
+	}
+
+	if unchanged != nil && os.Link(dstPath, stagedPath) == nil {
+		return nil
+	}
+
+	if err := os.WriteFile(stagedPath, content, 0644); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", stagedPath, err)
+	}
+
+	// where files can't be linked, keeping the modification time is the next best thing
+	if unchanged != nil {
+		_ = os.Chtimes(stagedPath, unchanged.ModTime(), unchanged.ModTime())
+	}
+
+	return nil
+}
+
+// sameContent returns the file info of the file at filePath if it holds exactly content, or nil.
+func sameContent(filePath string, content []byte) fs.FileInfo {
+	info, err := os.Stat(filePath)
+	if err != nil || !info.Mode().IsRegular() || info.Size() != int64(len(content)) {
+		return nil
+	}
+
+	existing, err := os.ReadFile(filePath)
+	if err != nil || !bytes.Equal(existing, content) {
+		return nil
+	}
+
+	return info
+}
+
+// Commit replaces the directory with the staging directory, and releases the lock. The old directory
+// is moved aside first and put back if the staging directory can't be moved into its place. Anything
+// in the old directory listed in Keep, and not written by the new build, is moved into the new one.
+// A full build written in place instead removes every file it didn't write, other than those in Keep.
+func (d *DirOutput) Commit() error {
+	defer d.release()
+
+	if d.staging == d.Dir {
+		if d.written != nil {
+			return d.removeLeftovers()
+		}
+		return nil
+	}
+
+	if err := d.swap(); err != nil {
+		_ = os.RemoveAll(d.staging)
+		return err
+	}
+
+	return nil
+}
+
+// keepPaths returns the paths listed in Keep as local paths within the directory, warning about and
+// ignoring any outside of it.
+func (d *DirOutput) keepPaths() []string {
+	kept := make([]string, 0, len(d.Keep))
+	for _, keep := range d.Keep {
+		keep = filepath.Clean(filepath.FromSlash(strings.TrimPrefix(keep, "/")))
+		if !filepath.IsLocal(keep) {
+			d.warning("ignoring kept path outside of the destination", "path", keep)
+			continue
+		}
+
+		kept = append(kept, keep)
+	}
+
+	return kept
+}
+
+// removeLeftovers removes everything in the directory not written by the last full build in place,
+// other than the paths in Keep.
+func (d *DirOutput) removeLeftovers() error {
+	kept := make(map[string]bool)
+	for _, keep := range d.kept {
+		kept[filepath.ToSlash(keep)] = true
+	}
+
+	dirs := make([]string, 0)
+	err := filepath.WalkDir(d.Dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(d.Dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		switch {
+		case kept[rel] && entry.IsDir():
+			return filepath.SkipDir
+		case kept[rel] || d.written[rel]:
+			return nil
+		case entry.IsDir():
+			dirs = append(dirs, p)
+			return nil
+		default:
+			return os.Remove(p)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove leftover files from %s: %w", d.Dir, err)
+	}
+
+	// directories are removed deepest first, once whatever was in them has gone
+	for _, dir := range slices.Backward(dirs) {
+		_ = os.Remove(dir)
+	}
+
+	return nil
+}
+
+// swap moves the staging directory into the place of the directory, carrying the kept paths over. If
+// anything can't be kept, the old directory is left beside it, and builds refuse to run until it has
+// been dealt with.
+func (d *DirOutput) swap() error {
+	old := siblingPath(d.Dir, "old")
+	if exists(old) {
+		return fmt.Errorf("%w: %s already exists", ErrorUnsafeDestination, old)
+	}
+
+	if err := os.Rename(d.Dir, old); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to move %s aside: %w", d.Dir, err)
+	}
+
+	if err := os.Rename(d.staging, d.Dir); err != nil {
+		_ = os.Rename(old, d.Dir)
+		return fmt.Errorf("failed to move %s to %s: %w", d.staging, d.Dir, err)
+	}
+
+	for _, keep := range d.kept {
+		if _, err := os.Lstat(filepath.Join(old, keep)); err != nil {
+			continue
+		}
+
+		if _, err := os.Lstat(filepath.Join(d.Dir, keep)); err == nil {
+			continue // the new build has its own copy
+		}
+
+		// the old destination is left in place if anything can't be kept, so nothing is lost
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(d.Dir, keep)), os.ModePerm); err != nil {
+			return fmt.Errorf("failed to keep %s, the previous output is still in %s: %w", keep, old, err)
+		}
+
+		if err := os.Rename(filepath.Join(old, keep), filepath.Join(d.Dir, keep)); err != nil {
+			return fmt.Errorf("failed to keep %s, the previous output is still in %s: %w", keep, old, err)
+		}
+	}
+
+	return os.RemoveAll(old)
+}
+
+// Abort removes the staging directory, leaving the directory as it was, and releases the lock.
+// Files already written in place can't be taken back.
+func (d *DirOutput) Abort() error {
+	defer d.release()
+
+	if d.staging == "" || d.staging == d.Dir {
+		return nil
+	}
+
+	return os.RemoveAll(d.staging)
+}
@@ -0,0 +1,336 @@
+package shizuka
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testDirOutput returns an output writing to dist in a new project directory.
+func testDirOutput(t *testing.T) *DirOutput {
+	t.Helper()
+
+	root := t.TempDir()
+	return &DirOutput{Dir: filepath.Join(root, "dist"), Root: root}
+}
+
+// writeBuild writes files to d as a full build.
+func writeBuild(t *testing.T, d *DirOutput, files map[string]string) {
+	t.Helper()
+
+	if err := d.Begin(true); err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	for name, content := range files {
+		if err := d.WriteFile(name, []byte(content)); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	if err := d.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+}
+
+// assertFiles checks which of names exist in d.
+func assertFiles(t *testing.T, d *DirOutput, names map[string]bool) {
+	t.Helper()
+
+	for name, want := range names {
+		_, err := os.Lstat(filepath.Join(d.Dir, filepath.FromSlash(name)))
+		if got := err == nil; got != want {
+			t.Errorf("%s: exists %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestDirOutputInPlace(t *testing.T) {
+	d := testDirOutput(t)
+	d.InPlace = true
+	d.Keep = []string{".git"}
+
+	writeBuild(t, d, map[string]string{"index.html": "a", "old/index.html": "b"})
+
+	mustWrite(t, filepath.Join(d.Dir, ".git", "HEAD"), "ref")
+
+	writeBuild(t, d, map[string]string{"index.html": "c", "new/index.html": "d"})
+
+	assertFiles(t, d, map[string]bool{
+		"index.html":     true,
+		"new/index.html": true,
+		"old/index.html": false,
+		"old":            false,
+		".git/HEAD":      true,
+		OutputMarker:     true,
+	})
+
+	// nothing is ever staged beside the directory
+	if _, err := os.Stat(siblingPath(d.Dir, "staging")); err == nil {
+		t.Errorf("staging directory created when writing in place")
+	}
+}
+
+func TestDirOutputLock(t *testing.T) {
+	d := testDirOutput(t)
+	lockPath := siblingPath(d.Dir, "lock")
+
+	// a lock held by a running process stops the build
+	mustWrite(t, lockPath, strconv.Itoa(os.Getpid()))
+	if err := d.Begin(true); !errors.Is(err, ErrorBuildLocked) {
+		t.Fatalf("Begin = %v, want %v", err, ErrorBuildLocked)
+	}
+	if err := d.Abort(); err != nil {
+		t.Fatalf("Abort: %v", err)
+	}
+	if _, err := os.Stat(lockPath); err != nil {
+		t.Fatalf("Abort after a failed Begin removed another build's lock")
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	// one left behind by a process which has exited is taken over
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("failed to run a process to take the id of: %v", err)
+	}
+	mustWrite(t, lockPath, strconv.Itoa(cmd.Process.Pid))
+
+	writeBuild(t, d, map[string]string{"index.html": "a"})
+
+	if _, err := os.Stat(lockPath); err == nil {
+		t.Errorf("lock still held after Commit")
+	}
+}
+
+func TestDirOutputWarnings(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stale locks aren't taken over on windows")
+	}
+
+	d := testDirOutput(t)
+	d.Keep = []string{"../outside"}
+
+	// a lock left behind by a process which has exited
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("failed to run a process to take the id of: %v", err)
+	}
+	lockPath := siblingPath(d.Dir, "lock")
+	mustWrite(t, lockPath, strconv.Itoa(cmd.Process.Pid))
+
+	pb := NewPageBuilder(testOutputSite(), d)
+	if err := pb.Index(); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	if err := pb.Build(); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	want := []string{
+		"ignoring kept path outside of the destination path=" + filepath.Join("..", "outside"),
+		"removing stale lock file path=" + lockPath + " pid=" + strconv.Itoa(cmd.Process.Pid),
+	}
+	if got := pb.Manifest().Warnings; !slices.Equal(got, want) {
+		t.Errorf("warnings %q, want %q", got, want)
+	}
+}
+
+func TestDirOutputCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, d *DirOutput)
+		ok    bool
+	}{
+		{
+			name:  "missing",
+			setup: func(t *testing.T, d *DirOutput) {},
+			ok:    true,
+		},
+		{
+			name: "empty",
+			setup: func(t *testing.T, d *DirOutput) {
+				mustMkdir(t, d.Dir)
+			},
+			ok: true,
+		},
+		{
+			name: "built by shizuka",
+			setup: func(t *testing.T, d *DirOutput) {
+				mustWrite(t, filepath.Join(d.Dir, OutputMarker), "")
+				mustWrite(t, filepath.Join(d.Dir, "index.html"), "")
+			},
+			ok: true,
+		},
+		{
+			name: "files without a marker",
+			setup: func(t *testing.T, d *DirOutput) {
+				mustWrite(t, filepath.Join(d.Dir, "notes.txt"), "")
+			},
+		},
+		{
+			name: "project directory",
+			setup: func(t *testing.T, d *DirOutput) {
+				d.Dir = d.Root
+			},
+		},
+		{
+			name: "outside the project",
+			setup: func(t *testing.T, d *DirOutput) {
+				d.Dir = t.TempDir()
+			},
+		},
+		{
+			name: "contains the source",
+			setup: func(t *testing.T, d *DirOutput) {
+				d.Src = filepath.Join(d.Dir, "site")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := testDirOutput(t)
+			test.setup(t, d)
+
+			err := d.Begin(true)
+			_ = d.Abort()
+
+			if test.ok && err != nil {
+				t.Errorf("Begin: %v", err)
+			} else if !test.ok && !errors.Is(err, ErrorUnsafeDestination) {
+				t.Errorf("Begin = %v, want %v", err, ErrorUnsafeDestination)
+			}
+		})
+	}
+}
+
+func TestDirOutputSwap(t *testing.T) {
+	d := testDirOutput(t)
+	d.Keep = []string{".git", "/CNAME", "../outside"}
+
+	writeBuild(t, d, map[string]string{"index.html": "a", "old/index.html": "b"})
+	mustWrite(t, filepath.Join(d.Dir, ".git", "HEAD"), "ref")
+	mustWrite(t, filepath.Join(d.Dir, "CNAME"), "old.example.com")
+
+	// a failed build leaves the output as it was
+	if err := d.Begin(true); err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if err := d.WriteFile("index.html", []byte("broken")); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := d.Abort(); err != nil {
+		t.Fatalf("Abort: %v", err)
+	}
+	assertContent(t, d, "index.html", "a")
+
+	writeBuild(t, d, map[string]string{"index.html": "c", "CNAME": "new.example.com"})
+
+	assertContent(t, d, "index.html", "c")
+	assertContent(t, d, "CNAME", "new.example.com") // the build's own copy wins
+	assertContent(t, d, ".git/HEAD", "ref")
+	assertFiles(t, d, map[string]bool{
+		"old/index.html": false,
+		OutputMarker:     true,
+	})
+
+	for _, suffix := range []string{"staging", "old", "lock"} {
+		if _, err := os.Stat(siblingPath(d.Dir, suffix)); err == nil {
+			t.Errorf("%s left behind", siblingPath(d.Dir, suffix))
+		}
+	}
+}
+
+func TestDirOutputFailedKeep(t *testing.T) {
+	d := testDirOutput(t)
+	d.Keep = []string{"sub/.git"}
+
+	writeBuild(t, d, map[string]string{"index.html": "a"})
+	mustWrite(t, filepath.Join(d.Dir, "sub", ".git", "HEAD"), "ref")
+
+	// the new build writes a file where the kept path's directory was, so it can't be carried over
+	if err := d.Begin(true); err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if err := d.WriteFile("sub", []byte("file")); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := d.Commit(); err == nil {
+		t.Fatalf("Commit succeeded without keeping sub/.git")
+	}
+
+	old := siblingPath(d.Dir, "old")
+	if got, err := os.ReadFile(filepath.Join(old, "sub", ".git", "HEAD")); err != nil || string(got) != "ref" {
+		t.Fatalf("previous output not left in %s: %q, %v", old, got, err)
+	}
+
+	// until it has been dealt with, builds refuse to run rather than remove it
+	if err := d.Begin(true); !errors.Is(err, ErrorUnsafeDestination) {
+		t.Errorf("Begin = %v, want %v", err, ErrorUnsafeDestination)
+	}
+	_ = d.Abort()
+
+	if _, err := os.Stat(filepath.Join(old, "sub", ".git", "HEAD")); err != nil {
+		t.Errorf("previous output removed: %v", err)
+	}
+}
+
+func TestDirOutputUnchangedFiles(t *testing.T) {
+	d := testDirOutput(t)
+	writeBuild(t, d, map[string]string{"same.html": "same", "changed.html": "old"})
+
+	past := time.Unix(1000000, 0)
+	for _, name := range []string{"same.html", "changed.html"} {
+		if err := os.Chtimes(filepath.Join(d.Dir, name), past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeBuild(t, d, map[string]string{"same.html": "same", "changed.html": "new"})
+
+	for name, kept := range map[string]bool{"same.html": true, "changed.html": false} {
+		info, err := os.Stat(filepath.Join(d.Dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.ModTime().Equal(past); got != kept {
+			t.Errorf("%s: kept modification time %v, want %v", name, got, kept)
+		}
+	}
+}
+
+func mustMkdir(t *testing.T, dir string) {
+	t.Helper()
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustWrite(t *testing.T, filePath, content string) {
+	t.Helper()
+
+	mustMkdir(t, filepath.Dir(filePath))
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// assertContent checks the content of the file name in d.
+func assertContent(t *testing.T, d *DirOutput, name, want string) {
+	t.Helper()
+
+	got, err := os.ReadFile(filepath.Join(d.Dir, filepath.FromSlash(name)))
+	if err != nil {
+		t.Errorf("%s: %v", name, err)
+	} else if string(got) != want {
+		t.Errorf("%s: %q, want %q", name, got, want)
+	}
+}
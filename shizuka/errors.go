@@ -0,0 +1,202 @@
+package shizuka
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"html/template"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrorTemplateNotFound  = errors.New("template not found")
+	ErrorBuildLocked       = errors.New("another build is writing to the destination")
+	ErrorUnsafeDestination = errors.New("refusing to replace destination")
+	ErrorDataConflict      = errors.New("data files share a key")
+)
+
+// execErrorPattern matches the message of a text/template ExecError, e.g.
+// template: post.tmpl:12:5: executing "post.tmpl" at <.Foo.Bar>: can't evaluate field Bar
+var execErrorPattern = regexp.MustCompile(`^template: ([^:]+):(\d+):(\d+): executing "[^"]*" at <(.*?)>: (.*)$`)
+
+// RenderError describes a page which failed to render.
+type RenderError struct {
+	Path     string // the path of the page being rendered
+	Source   string // the content file the page was built from, if any
+	Template string // the name of the template being executed
+	File     string // the file the failing template was parsed from, if known
+	Line     int    // the line of the failing action, or 0 if unknown
+	Column   int    // the column of the failing action, or 0 if unknown
+	Action   string // the failing action, e.g. ".Foo.Bar"
+	Err      error
+}
+
+func (e *RenderError) Error() string {
+	var b strings.Builder
+
+	b.WriteString(e.Path)
+	if e.Source != "" {
+		fmt.Fprintf(&b, " (%s)", e.Source)
+	}
+
+	if e.File != "" {
+		fmt.Fprintf(&b, ": %s", e.File)
+	} else {
+		fmt.Fprintf(&b, ": %s", e.Template)
+	}
+
+	if e.Line > 0 {
+		fmt.Fprintf(&b, ":%d", e.Line)
+	}
+	if e.Column > 0 {
+		fmt.Fprintf(&b, ":%d", e.Column)
+	}
+
+	if e.Action != "" {
+		fmt.Fprintf(&b, ": at <%s>", e.Action)
+	}
+
+	fmt.Fprintf(&b, ": %v", e.Err)
+
+	return b.String()
+}
+
+func (e *RenderError) Unwrap() error {
+	return e.Err
+}
+
+// PageError describes a content file or generated record which couldn't be made into a page.
+type PageError struct {
+	Source string // the content file or data record the page was to be built from
+	Err    error
+}
+
+func (e *PageError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Source, e.Err)
+}
+
+func (e *PageError) Unwrap() error {
+	return e.Err
+}
+
+// IndexError collects every page which failed to index, so wasn't built.
+type IndexError struct {
+	Errors []*PageError // ordered by source
+}
+
+func (e *IndexError) Error() string {
+	if len(e.Errors) == 1 {
+		return fmt.Sprintf("1 page failed to index: %v", e.Errors[0])
+	}
+
+	return fmt.Sprintf("%d pages failed to index", len(e.Errors))
+}
+
+// BuildError collects every page which failed to render during a build.
+type BuildError struct {
+	Errors []*RenderError // ordered by page path
+}
+
+func (e *BuildError) Error() string {
+	if len(e.Errors) == 1 {
+		return fmt.Sprintf("1 page failed to render: %v", e.Errors[0])
+	}
+
+	return fmt.Sprintf("%d pages failed to render", len(e.Errors))
+}
+
+// Grouped returns the render errors grouped by the template file they occurred in, with the groups
+// ordered by file name.
+func (e *BuildError) Grouped() (files []string, groups map[string][]*RenderError) {
+	groups = make(map[string][]*RenderError)
+	for _, err := range e.Errors {
+		file := err.File
+		if file == "" {
+			file = err.Template
+		}
+
+		if _, ok := groups[file]; !ok {
+			files = append(files, file)
+		}
+		groups[file] = append(groups[file], err)
+	}
+
+	slices.Sort(files)
+
+	return files, groups
+}
+
+// newRenderError breaks a template error down into the location and action it occurred at.
+func (pb *PageBuilder) newRenderError(path, source, name string, err error) *RenderError {
+	renderErr := &RenderError{
+		Path:     path,
+		Source:   source,
+		Template: name,
+		File:     pb.templateFiles[name],
+		Err:      err,
+	}
+
+	var escapeErr *template.Error
+	if errors.As(err, &escapeErr) {
+		renderErr.Template = escapeErr.Name
+		renderErr.File = pb.templateFiles[escapeErr.Name]
+		renderErr.Line = escapeErr.Line
+		renderErr.Err = errors.New(escapeErr.Description)
+		return renderErr
+	}
+
+	if m := execErrorPattern.FindStringSubmatch(err.Error()); m != nil {
+		renderErr.Template = m[1]
+		renderErr.File = pb.templateFiles[m[1]]
+		renderErr.Line, _ = strconv.Atoi(m[2])
+		renderErr.Column, _ = strconv.Atoi(m[3])
+		renderErr.Action = m[4]
+		renderErr.Err = errors.New(m[5])
+	}
+
+	return renderErr
+}
+
+// addRenderError records a page which failed to render. It is safe to call while rendering in parallel.
+func (pb *PageBuilder) addRenderError(err *RenderError) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	pb.errors = append(pb.errors, err)
+}
+
+// renderErrors returns the errors collected while rendering, or nil if every page rendered.
+func (pb *PageBuilder) renderErrors() error {
+	if len(pb.errors) == 0 {
+		return nil
+	}
+
+	// pages are rendered in parallel, so errors are recorded in no particular order
+	errs := slices.Clone(pb.errors)
+	slices.SortStableFunc(errs, func(a, b *RenderError) int {
+		return cmp.Or(
+			strings.Compare(a.Path, b.Path),
+			strings.Compare(a.Template, b.Template),
+			strings.Compare(a.Source, b.Source),
+		)
+	})
+
+	return &BuildError{Errors: errs}
+}
+
+// indexErrors returns the errors collected while indexing, or nil if every page was indexed.
+func (pb *PageBuilder) indexErrors() error {
+	if len(pb.pageErrors) == 0 {
+		return nil
+	}
+
+	errs := slices.Clone(pb.pageErrors)
+	slices.SortStableFunc(errs, func(a, b *PageError) int {
+		return strings.Compare(a.Source, b.Source)
+	})
+
+	return &IndexError{Errors: errs}
+}
@@ -0,0 +1,137 @@
+package shizuka
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+// exifHeaderSize is how much of a jpeg is read for its EXIF data, which comes before the image data
+// and is limited to a single 64KB segment.
+const exifHeaderSize = 64 * 1024
+
+// jpegOrientation returns the EXIF orientation of a jpeg from the start of its file, from 1 to 8, or 1
+// if it doesn't have one. Cameras store photos as the sensor saw them and record which way up they
+// were taken here, leaving viewers to turn them the right way.
+func jpegOrientation(header []byte) int {
+	if len(header) < 2 || header[0] != 0xFF || header[1] != 0xD8 {
+		return 1 // not a jpeg
+	}
+
+	for i := 2; i+4 <= len(header); {
+		if header[i] != 0xFF {
+			return 1
+		}
+
+		marker := header[i+1]
+		if marker == 0xDA || marker == 0xD9 {
+			return 1 // the image data starts before any EXIF segment
+		}
+
+		size := int(binary.BigEndian.Uint16(header[i+2:]))
+		if size < 2 {
+			return 1
+		}
+
+		end := min(i+2+size, len(header))
+		if marker == 0xE1 && bytes.HasPrefix(header[i+4:end], []byte("Exif\x00\x00")) {
+			return tiffOrientation(header[i+10 : end])
+		}
+
+		i += 2 + size
+	}
+
+	return 1
+}
+
+// tiffOrientation reads the orientation tag from the first IFD of the TIFF structure EXIF data is
+// stored in.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+
+		// the orientation is a single short, stored in the entry itself
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if orientation := int(order.Uint16(tiff[entry+8:])); orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+			return 1
+		}
+	}
+
+	return 1
+}
+
+// orientationSwapsAxes reports whether an orientation turns an image on its side, so that its width
+// and height swap when it is shown the right way up.
+func orientationSwapsAxes(orientation int) bool {
+	return orientation >= 5 && orientation <= 8
+}
+
+// orientImage turns src the right way up for its EXIF orientation.
+func orientImage(src image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, src.Bounds().Dx(), src.Bounds().Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, src.Bounds().Min, draw.Src)
+
+	w, h := rgba.Bounds().Dx(), rgba.Bounds().Dy()
+	dw, dh := w, h
+	if orientationSwapsAxes(orientation) {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			// where the pixel shown at x, y is stored
+			var sx, sy int
+			switch orientation {
+			case 2: // flipped horizontally
+				sx, sy = w-1-x, y
+			case 3: // turned upside down
+				sx, sy = w-1-x, h-1-y
+			case 4: // flipped vertically
+				sx, sy = x, h-1-y
+			case 5: // flipped along the top-left to bottom-right diagonal
+				sx, sy = y, x
+			case 6: // taken turned a quarter anticlockwise, so shown turned a quarter clockwise
+				sx, sy = y, h-1-x
+			case 7: // flipped along the top-right to bottom-left diagonal
+				sx, sy = w-1-y, h-1-x
+			case 8: // taken turned a quarter clockwise, so shown turned a quarter anticlockwise
+				sx, sy = w-1-y, x
+			}
+
+			copy(dst.Pix[dst.PixOffset(x, y):][:4], rgba.Pix[rgba.PixOffset(sx, sy):][:4])
+		}
+	}
+
+	return dst
+}
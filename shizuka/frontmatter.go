@@ -33,6 +33,36 @@ type Frontmatter struct {
 	LiteData map[string]any `yaml:"lite_data"`
 
 	Template string `yaml:"template"`
+
+	Outputs []string `yaml:"outputs"`
+
+	Paginate     int    `yaml:"paginate"`
+	PaginatePath string `yaml:"paginate_path"`
+
+	// Extra collects any keys not listed above, such as user-defined taxonomies.
+	Extra map[string]any `yaml:",inline"`
+}
+
+// Terms returns the terms the frontmatter lists under the given taxonomy.
+func (f *Frontmatter) Terms(taxonomy string) []string {
+	if taxonomy == "tags" {
+		return f.Tags
+	}
+
+	switch v := f.Extra[taxonomy].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		terms := make([]string, 0, len(v))
+		for _, term := range v {
+			if s, ok := term.(string); ok {
+				terms = append(terms, s)
+			}
+		}
+		return terms
+	default:
+		return nil
+	}
 }
 
 // extractFrontmatter parses the YAML frontmatter and returns the remaining body content.
@@ -0,0 +1,22 @@
+package shizuka
+
+import (
+	"encoding/json"
+	"html/template"
+)
+
+// funcMap returns the functions available to every template.
+func (pb *PageBuilder) funcMap() template.FuncMap {
+	return pb.pluginFuncs(template.FuncMap{
+		"slug":      func(term string) string { return slugify(normaliseTerm(term)) },
+		"i18n":      pb.translate(pb.Opts.Languages.Default),
+		"asset":     pb.assetPath,
+		"srcset":    pb.imageSrcset,
+		"thumbnail": pb.imageThumbnail,
+		"img":       pb.imageTag,
+		"jsonify": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	})
+}
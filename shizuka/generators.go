@@ -0,0 +1,132 @@
+package shizuka
+
+import (
+	"fmt"
+	"github.com/yuin/goldmark"
+	"gopkg.in/yaml.v3"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// generatorParam matches the :field placeholders in a generator's path pattern.
+var generatorParam = regexp.MustCompile(`:([A-Za-z0-9_]+)`)
+
+// Generator creates a page for every record in a data file.
+type Generator struct {
+	Data     string `json:"data"`     // the data file to read records from, without the extension, e.g. "projects"
+	Template string `json:"template"` // the template to render each record with, unless the record sets one
+	Path     string `json:"path"`     // the path pattern of each page, e.g. "/projects/:slug/"
+
+	SitemapInclude bool `json:"sitemap_include"` // whether to include every page in the sitemap
+	RSSInclude     bool `json:"rss_include"`     // whether to include every page in the RSS feed
+}
+
+// generatorPath fills in the :field placeholders of pattern from a record. Fields are slugged, and a
+// field the record doesn't have is an error.
+func generatorPath(pattern string, record map[string]any) (string, error) {
+	var missing []string
+	relPath := generatorParam.ReplaceAllStringFunc(pattern, func(param string) string {
+		value, ok := record[param[1:]]
+		if !ok {
+			missing = append(missing, param[1:])
+			return ""
+		}
+
+		return slugify(fmt.Sprint(value))
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("record is missing %s", strings.Join(missing, ", "))
+	}
+
+	relPath = "/" + strings.Trim(relPath, "/")
+	return relPath, nil
+}
+
+// indexGenerators adds a page for every record of every generator. Each record is read as if it were
+// the frontmatter of a page, so it can set a title, date, tags and so on, and is available to the
+// template as .Data. A "content" field is rendered as markdown. Records which can't be made into a
+// page are skipped with a warning, and are given as "<data file>#<index>", e.g. data/projects.yaml#2.
+// An error from a hook fails the index, as it does for content files.
+func (pb *PageBuilder) indexGenerators(md goldmark.Markdown) {
+	for _, gen := range pb.Opts.Generators {
+		dataFile, ok := pb.dataFiles[gen.Data]
+		if !ok {
+			pb.warn("generator data file not found, skipping", "data", gen.Data)
+			continue
+		}
+
+		records, ok := pb.data[gen.Data].([]any)
+		if !ok {
+			pb.warn("generator data is not a list, skipping", "data", dataFile)
+			continue
+		}
+
+		for i, r := range records {
+			source := fmt.Sprintf("%s#%d", dataFile, i)
+
+			record, ok := r.(map[string]any)
+			if !ok {
+				pb.warn("generator record is not a map, skipping", "record", source)
+				continue
+			}
+
+			if err := pb.indexRecord(md, gen, source, record); err != nil {
+				pb.warn("failed to generate page, skipping", "record", source, "error", err)
+			}
+		}
+	}
+}
+
+// indexRecord makes a record into a page. Problems with the record itself are returned, so it is
+// skipped with a warning, while a page which fails to build is recorded as a content file's would be.
+func (pb *PageBuilder) indexRecord(md goldmark.Markdown, gen Generator, source string, record map[string]any) error {
+	relPath, err := generatorPath(gen.Path, record)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := pb.pages[relPath]; ok {
+		return fmt.Errorf("a page already exists at %s", relPath)
+	}
+
+	raw, err := yaml.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to read record: %w", err)
+	}
+
+	frontmatter := &Frontmatter{
+		Template:       gen.Template,
+		SitemapInclude: gen.SitemapInclude,
+		RSSInclude:     gen.RSSInclude,
+	}
+	if err := yaml.Unmarshal(raw, frontmatter); err != nil {
+		return fmt.Errorf("failed to read record: %w", err)
+	}
+	frontmatter.Data = record
+
+	file := Location{
+		SrcPath: source,
+		DstPath: path.Join(relPath, "index.html"),
+		RelPath: relPath,
+		Lang:    pb.Opts.Languages.Match(relPath),
+	}
+
+	if err := pb.afterFrontmatter(file, frontmatter); err != nil {
+		pb.addParsedPage(parsedPage{file: file, err: err})
+		return nil
+	}
+
+	var html []byte
+	if content, ok := record["content"].(string); ok {
+		if html, err = pb.convertMarkdown(md, file, []byte(content)); err != nil {
+			pb.addParsedPage(parsedPage{file: file, err: fmt.Errorf("failed to build record content: %w", err)})
+			return nil
+		}
+	}
+
+	pb.addParsedPage(parsedPage{file: file, frontmatter: frontmatter, content: html})
+
+	return nil
+}
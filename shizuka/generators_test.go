@@ -0,0 +1,49 @@
+package shizuka
+
+import (
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+func TestIndexGenerators(t *testing.T) {
+	fsys := fstest.MapFS{
+		"templates/project.tmpl": {Data: []byte(`{{ .Title }}`)},
+		"data/projects.yaml": {Data: []byte(`
+- slug: one
+  title: One
+- title: Missing a slug
+- just a string
+`)},
+		"data/settings.yaml": {Data: []byte("theme: dark")},
+	}
+
+	out := NewMapOutput()
+	pb := NewPageBuilder(fsys, out)
+	pb.Opts.Generators = []Generator{
+		{Data: "projects", Template: "project.tmpl", Path: "/projects/:slug"},
+		{Data: "settings", Template: "project.tmpl", Path: "/settings/:slug"},
+		{Data: "missing", Template: "project.tmpl", Path: "/missing/:slug"},
+	}
+
+	if err := pb.Index(); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	if err := pb.Build(); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	if got := string(out.Files["projects/one/index.html"]); got != "One" {
+		t.Errorf("projects/one/index.html: %q, want %q", got, "One")
+	}
+
+	want := []string{
+		"failed to generate page, skipping record=data/projects.yaml#1 error=record is missing slug",
+		"generator data file not found, skipping data=missing",
+		"generator data is not a list, skipping data=data/settings.yaml",
+		"generator record is not a map, skipping record=data/projects.yaml#2",
+	}
+	if got := pb.Manifest().Warnings; !slices.Equal(got, want) {
+		t.Errorf("warnings %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,185 @@
+package shizuka
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/yuin/goldmark"
+	"html/template"
+)
+
+// Plugin customises how a site is built. Plugins are registered on a page builder with Use, and
+// take part in the build by implementing any of the hook interfaces below. As content files are
+// parsed and pages are rendered in parallel, hooks which run per page must be safe to call from
+// many goroutines at once.
+type Plugin interface {
+	Name() string // the plugin's name, which is given in errors from its hooks
+}
+
+// FrontmatterHook is called with the frontmatter of every page once it has been parsed, including
+// pages generated from data files, and may change it.
+type FrontmatterHook interface {
+	Plugin
+	AfterFrontmatter(file Location, frontmatter *Frontmatter) error
+}
+
+// BeforeMarkdownHook is called with the markdown of every content file before it is converted, with
+// the frontmatter removed, and returns the markdown to convert in its place.
+type BeforeMarkdownHook interface {
+	Plugin
+	BeforeMarkdown(file Location, markdown []byte) ([]byte, error)
+}
+
+// AfterMarkdownHook is called with the html converted from every content file, and returns the html
+// to use in its place as the page's .Content.
+type AfterMarkdownHook interface {
+	Plugin
+	AfterMarkdown(file Location, html []byte) ([]byte, error)
+}
+
+// ExtensionHook adds goldmark extensions to the markdown converter.
+type ExtensionHook interface {
+	Plugin
+	Extensions() []goldmark.Extender
+}
+
+// FuncsHook adds functions to templates. They replace any built-in functions of the same name.
+type FuncsHook interface {
+	Plugin
+	Funcs() template.FuncMap
+}
+
+// AfterRenderHook is called with every page rendered from a template, before it is minified and
+// written to name in the output, and returns the content to write in its place.
+type AfterRenderHook interface {
+	Plugin
+	AfterRender(name string, data PageData, content []byte) ([]byte, error)
+}
+
+// AfterBuildHook is called once every page of a build or rebuild has been written without errors,
+// before the output is committed. out adds files to the output, and manifest lists every file in it
+// so far. Returning an error fails the build, leaving the previous output in place.
+type AfterBuildHook interface {
+	Plugin
+	AfterBuild(out FileWriter, manifest *Manifest) error
+}
+
+// FileWriter writes files to the output of a build, at slash-separated paths relative to its root.
+type FileWriter interface {
+	WriteFile(name string, content []byte) error
+}
+
+// Use registers plugins on the page builder, to take part in the next Index and Build. Hooks are
+// called in the order their plugins were registered.
+func (pb *PageBuilder) Use(plugins ...Plugin) {
+	pb.plugins = append(pb.plugins, plugins...)
+}
+
+// pluginError attributes an error returned by a hook to its plugin.
+func pluginError(plugin Plugin, err error) error {
+	return fmt.Errorf("plugin %s: %w", plugin.Name(), err)
+}
+
+// afterFrontmatter calls every FrontmatterHook.
+func (pb *PageBuilder) afterFrontmatter(file Location, frontmatter *Frontmatter) error {
+	for _, plugin := range pb.plugins {
+		if hook, ok := plugin.(FrontmatterHook); ok {
+			if err := hook.AfterFrontmatter(file, frontmatter); err != nil {
+				return pluginError(plugin, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// convertMarkdown converts the markdown of a content file to html, passing it through every
+// BeforeMarkdownHook and AfterMarkdownHook.
+func (pb *PageBuilder) convertMarkdown(md goldmark.Markdown, file Location, markdown []byte) ([]byte, error) {
+	for _, plugin := range pb.plugins {
+		if hook, ok := plugin.(BeforeMarkdownHook); ok {
+			var err error
+			if markdown, err = hook.BeforeMarkdown(file, markdown); err != nil {
+				return nil, pluginError(plugin, err)
+			}
+		}
+	}
+
+	htmlBuf := bytes.NewBuffer(nil)
+	if err := md.Convert(markdown, htmlBuf); err != nil {
+		return nil, err
+	}
+
+	html := htmlBuf.Bytes()
+	for _, plugin := range pb.plugins {
+		if hook, ok := plugin.(AfterMarkdownHook); ok {
+			var err error
+			if html, err = hook.AfterMarkdown(file, html); err != nil {
+				return nil, pluginError(plugin, err)
+			}
+		}
+	}
+
+	return html, nil
+}
+
+// markdownExtensions returns the goldmark extensions added by every ExtensionHook.
+func (pb *PageBuilder) markdownExtensions() []goldmark.Extender {
+	extensions := make([]goldmark.Extender, 0)
+	for _, plugin := range pb.plugins {
+		if hook, ok := plugin.(ExtensionHook); ok {
+			extensions = append(extensions, hook.Extensions()...)
+		}
+	}
+
+	return extensions
+}
+
+// pluginFuncs adds the template functions of every FuncsHook to funcs.
+func (pb *PageBuilder) pluginFuncs(funcs template.FuncMap) template.FuncMap {
+	for _, plugin := range pb.plugins {
+		if hook, ok := plugin.(FuncsHook); ok {
+			for name, fn := range hook.Funcs() {
+				funcs[name] = fn
+			}
+		}
+	}
+
+	return funcs
+}
+
+// afterRender passes a rendered page through every AfterRenderHook.
+func (pb *PageBuilder) afterRender(dstPath string, data PageData, content []byte) ([]byte, error) {
+	for _, plugin := range pb.plugins {
+		if hook, ok := plugin.(AfterRenderHook); ok {
+			var err error
+			if content, err = hook.AfterRender(outputName(dstPath), data, content); err != nil {
+				return nil, pluginError(plugin, err)
+			}
+		}
+	}
+
+	return content, nil
+}
+
+// pluginWriter is the FileWriter given to AfterBuild hooks, which records the files written in the
+// manifest.
+type pluginWriter struct {
+	pb *PageBuilder
+}
+
+func (w pluginWriter) WriteFile(name string, content []byte) error {
+	return w.pb.writeFile(name, content)
+}
+
+// afterBuild calls every AfterBuildHook.
+func (pb *PageBuilder) afterBuild() error {
+	for _, plugin := range pb.plugins {
+		if hook, ok := plugin.(AfterBuildHook); ok {
+			if err := hook.AfterBuild(pluginWriter{pb: pb}, pb.Manifest()); err != nil {
+				return pluginError(plugin, err)
+			}
+		}
+	}
+
+	return nil
+}
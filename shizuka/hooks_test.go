@@ -0,0 +1,96 @@
+package shizuka
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+// afterBuildPlugin counts its AfterBuild calls, writing a file on each.
+type afterBuildPlugin struct {
+	calls int
+}
+
+func (p *afterBuildPlugin) Name() string { return "after-build" }
+
+func (p *afterBuildPlugin) AfterBuild(out FileWriter, manifest *Manifest) error {
+	p.calls++
+	return out.WriteFile("extra.txt", []byte("extra"))
+}
+
+// failingPlugin fails the frontmatter of one source.
+type failingPlugin struct {
+	source string
+}
+
+func (p failingPlugin) Name() string { return "failing" }
+
+func (p failingPlugin) AfterFrontmatter(file Location, frontmatter *Frontmatter) error {
+	if file.SrcPath == p.source {
+		return errors.New("bad page")
+	}
+
+	return nil
+}
+
+func TestHookErrorFailsIndex(t *testing.T) {
+	for _, source := range []string{"content/index.md", "data/projects.yaml#0"} {
+		t.Run(source, func(t *testing.T) {
+			fsys := testOutputSite()
+			fsys["data/projects.yaml"] = &fstest.MapFile{Data: []byte("- slug: one\n")}
+
+			out := NewMapOutput()
+			pb := NewPageBuilder(fsys, out)
+			pb.Opts.Generators = []Generator{{Data: "projects", Template: "page.tmpl", Path: "/projects/:slug"}}
+			pb.Use(failingPlugin{source: source})
+
+			var indexErr *IndexError
+			if err := pb.Index(); !errors.As(err, &indexErr) {
+				t.Fatalf("Index = %v, want an IndexError", err)
+			}
+			if len(indexErr.Errors) != 1 || indexErr.Errors[0].Source != source {
+				t.Errorf("Index failed for %v, want %s", indexErr.Errors, source)
+			}
+
+			if err := pb.Build(); !errors.As(err, &indexErr) {
+				t.Errorf("Build = %v, want an IndexError", err)
+			}
+			if len(out.Files) != 0 {
+				t.Errorf("Build wrote %d files after a failed index", len(out.Files))
+			}
+		})
+	}
+}
+
+func TestAfterBuildHook(t *testing.T) {
+	fsys := testOutputSite()
+	plugin := &afterBuildPlugin{}
+
+	out := NewMapOutput()
+	pb := NewPageBuilder(fsys, out)
+	pb.Use(plugin)
+
+	if err := pb.Index(); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	if err := pb.Build(); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if plugin.calls != 1 || string(out.Files["extra.txt"]) != "extra" {
+		t.Fatalf("AfterBuild called %d times, wrote %q", plugin.calls, out.Files["extra.txt"])
+	}
+
+	// a build with render errors fails before the hooks run
+	fsys["templates/page.tmpl"] = &fstest.MapFile{Data: []byte(`{{ .Missing.Field }}`)}
+	if err := pb.Index(); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+
+	var buildErr *BuildError
+	if err := pb.Build(); !errors.As(err, &buildErr) {
+		t.Fatalf("Build = %v, want a BuildError", err)
+	}
+	if plugin.calls != 1 {
+		t.Errorf("AfterBuild called after a failed build")
+	}
+}
@@ -0,0 +1,187 @@
+package shizuka
+
+import (
+	"cmp"
+	"fmt"
+	"html/template"
+	"path"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Language is one of the languages a site is published in.
+type Language struct {
+	Code   string `json:"code"`   // the language code, used in filenames (1.ja.md) and directories (content/ja/)
+	Name   string `json:"name"`   // the name of the language, for language switchers
+	Prefix string `json:"prefix"` // the URL prefix of pages in this language, e.g. "/ja"
+}
+
+// Languages is every language a site is published in.
+type Languages struct {
+	Default string     // the language of content without a language in its path
+	List    []Language // every language, including the default
+}
+
+// Get looks up a language by code.
+func (l Languages) Get(code string) (Language, bool) {
+	for _, lang := range l.List {
+		if lang.Code == code {
+			return lang, true
+		}
+	}
+
+	return Language{Code: code}, false
+}
+
+// Split removes the language from the path of a content file, returning the language and the path
+// without it. The language is read from the first directory (/ja/posts/1.md) or from the filename
+// (/posts/1.ja.md), falling back to the default language.
+func (l Languages) Split(relPath string) (lang, rest string) {
+	if len(l.List) == 0 {
+		return l.Default, relPath
+	}
+
+	first, remaining, _ := strings.Cut(strings.TrimPrefix(relPath, "/"), "/")
+	if _, ok := l.Get(first); ok {
+		return first, "/" + remaining
+	}
+
+	dir, file := path.Split(relPath)
+	ext := path.Ext(file)
+	name := strings.TrimSuffix(file, ext)
+	if _, ok := l.Get(strings.TrimPrefix(path.Ext(name), ".")); ok {
+		return strings.TrimPrefix(path.Ext(name), "."), dir + strings.TrimSuffix(name, path.Ext(name)) + ext
+	}
+
+	return l.Default, relPath
+}
+
+// Prefix returns the URL prefix of a language.
+func (l Languages) Prefix(code string) string {
+	lang, _ := l.Get(code)
+	return strings.TrimSuffix(lang.Prefix, "/")
+}
+
+// Match finds the language of an output path from its prefix.
+func (l Languages) Match(relPath string) string {
+	match, matchLen := l.Default, -1
+	for _, lang := range l.List {
+		prefix := l.Prefix(lang.Code)
+		if (relPath == prefix || strings.HasPrefix(relPath, prefix+"/")) && len(prefix) > matchLen {
+			match, matchLen = lang.Code, len(prefix)
+		}
+	}
+
+	return match
+}
+
+// TranslationKey returns the path of a page with its language prefix removed, which is shared by
+// every translation of the page.
+func (l Languages) TranslationKey(lang, relPath string) string {
+	key := strings.TrimPrefix(relPath, l.Prefix(lang))
+	if key == "" {
+		return "/"
+	}
+
+	return key
+}
+
+// indexTranslations links every page to its translations, and adds them to the sitemap as alternates.
+func (pb *PageBuilder) indexTranslations() {
+	pb.translations = make(map[string][]Lite)
+	if len(pb.Opts.Languages.List) == 0 {
+		return
+	}
+
+	for _, page := range pb.pages {
+		pb.translations[page.TranslationKey] = append(pb.translations[page.TranslationKey], page.Lite())
+	}
+
+	for _, translations := range pb.translations {
+		slices.SortFunc(translations, func(a, b Lite) int {
+			return cmp.Or(strings.Compare(a.Lang, b.Lang), strings.Compare(a.Path, b.Path))
+		})
+
+		if !pb.Opts.UseSitemap || len(translations) < 2 {
+			continue
+		}
+
+		for _, page := range translations {
+			for _, translation := range translations {
+				pb.sitemap.AddAlternate(page.Path, translation.Lang, translation.Path)
+			}
+		}
+	}
+}
+
+// pageTranslations returns the other translations of a page.
+func (pb *PageBuilder) pageTranslations(page Page) []Lite {
+	translations := make([]Lite, 0)
+	for _, translation := range pb.translations[page.TranslationKey] {
+		if translation.Path != page.Location.RelPath {
+			translations = append(translations, translation)
+		}
+	}
+
+	return translations
+}
+
+// feed returns the RSS feed for a language, creating it if needed.
+func (pb *PageBuilder) feed(lang string) *RSS {
+	if rss, ok := pb.feeds[lang]; ok {
+		return rss
+	}
+
+	rss := NewRSS(pb.Opts.BaseURL, pb.Opts.SiteTitle, pb.Opts.SiteDescription, lang, pb.buildTime)
+	rss.Channel.AtomLink.Href = permalink(pb.Opts.BaseURL, pb.Opts.Languages.Prefix(lang)+"/rss.xml")
+	pb.feeds[lang] = rss
+
+	return rss
+}
+
+// translate returns the i18n template function for a language. Strings are looked up in
+// data/i18n/<lang>.yaml, then in the default language, and finally fall back to the key itself.
+// Any arguments are formatted into the string with fmt.Sprintf.
+func (pb *PageBuilder) translate(lang string) func(key string, args ...any) string {
+	return func(key string, args ...any) string {
+		tables, _ := pb.data["i18n"].(map[string]any)
+
+		for _, code := range []string{lang, pb.Opts.Languages.Default} {
+			table, _ := tables[code].(map[string]any)
+			if value, ok := table[key]; ok {
+				if len(args) > 0 {
+					return fmt.Sprintf(fmt.Sprint(value), args...)
+				}
+				return fmt.Sprint(value)
+			}
+		}
+
+		return key
+	}
+}
+
+// localiseTemplates clones the templates for each language, binding i18n to that language.
+func (pb *PageBuilder) localiseTemplates() error {
+	pb.langTemplates = make(map[string]*template.Template)
+	pb.langTextTemplates = make(map[string]*texttemplate.Template)
+
+	for _, lang := range pb.Opts.Languages.List {
+		funcs := map[string]any{"i18n": pb.translate(lang.Code)}
+
+		temp, err := pb.templates.Clone()
+		if err != nil {
+			return fmt.Errorf("failed to clone templates for %s: %w", lang.Code, err)
+		}
+
+		textTemp, err := pb.textTemplates.Clone()
+		if err != nil {
+			return fmt.Errorf("failed to clone templates for %s: %w", lang.Code, err)
+		}
+
+		pb.langTemplates[lang.Code] = temp.Funcs(funcs)
+		pb.langTextTemplates[lang.Code] = textTemp.Funcs(funcs)
+	}
+
+	return nil
+}
@@ -0,0 +1,371 @@
+package shizuka
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultImageCacheDir is where the shizuka command keeps processed images between builds.
+const DefaultImageCacheDir = ".shizuka_cache/images"
+
+// ImageOpts configures the resizing of images in static/.
+type ImageOpts struct {
+	Widths          []int  `json:"widths"`           // the widths to resize each image to, for srcset
+	ThumbnailWidth  int    `json:"thumbnail_width"`  // the width of thumbnails, or 0 to skip them
+	ThumbnailHeight int    `json:"thumbnail_height"` // the height of thumbnails, which are cropped to fit
+	Quality         int    `json:"quality"`          // the jpeg quality, from 1 to 100
+	CacheDir        string `json:"cache_dir"`        // where processed images are kept between builds, or empty not to keep them
+}
+
+// imageVariant is a resized copy of an image.
+type imageVariant struct {
+	Path   string // the path the variant is published at
+	Width  int
+	Height int
+	Crop   bool // whether to crop to Width x Height rather than keep the aspect ratio
+}
+
+// responsiveImage is an image in static/, along with the variants made of it.
+type responsiveImage struct {
+	Source      Location
+	Width       int // the width the image is shown at, once turned the right way up
+	Height      int
+	Orientation int            // the EXIF orientation of a jpeg, which variants are turned by
+	Variants    []imageVariant // resized copies, narrowest first
+	Thumbnail   *imageVariant
+}
+
+func (opts ImageOpts) enabled() bool {
+	return len(opts.Widths) > 0 || opts.ThumbnailWidth > 0
+}
+
+// isImage reports whether a static file can be resized.
+func isImage(relPath string) bool {
+	switch strings.ToLower(path.Ext(relPath)) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	default:
+		return false
+	}
+}
+
+// variantPath inserts a suffix before the extension of relPath, e.g. photo.480w.jpg.
+func variantPath(relPath, suffix string) string {
+	ext := path.Ext(relPath)
+	return strings.TrimSuffix(relPath, ext) + "." + suffix + ext
+}
+
+// indexImages plans the variants of every image in static/, without processing them yet.
+func (pb *PageBuilder) indexImages() error {
+	pb.images = make(map[string]*responsiveImage)
+
+	opts := pb.Opts.Images
+	if !opts.enabled() {
+		return nil
+	}
+
+	for _, location := range pb.static {
+		if !isImage(location.RelPath) {
+			continue
+		}
+
+		file, err := pb.fsys.Open(location.SrcPath)
+		if err != nil {
+			return fmt.Errorf("failed to open image %s: %w", location.SrcPath, err)
+		}
+
+		// only the start of the file is read, for its size and orientation
+		header := make([]byte, exifHeaderSize)
+		n, err := io.ReadFull(file, header)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			_ = file.Close()
+			return fmt.Errorf("failed to read image %s: %w", location.SrcPath, err)
+		}
+		header = header[:n]
+
+		config, _, err := image.DecodeConfig(io.MultiReader(bytes.NewReader(header), file))
+		_ = file.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read image %s: %w", location.SrcPath, err)
+		}
+
+		orientation := jpegOrientation(header)
+		if orientationSwapsAxes(orientation) {
+			config.Width, config.Height = config.Height, config.Width
+		}
+
+		img := &responsiveImage{
+			Source:      location,
+			Width:       config.Width,
+			Height:      config.Height,
+			Orientation: orientation,
+		}
+
+		for _, width := range opts.Widths {
+			if width <= 0 || width >= config.Width {
+				continue // images are never scaled up
+			}
+
+			img.Variants = append(img.Variants, imageVariant{
+				Path:   variantPath(location.RelPath, strconv.Itoa(width)+"w"),
+				Width:  width,
+				Height: max(1, config.Height*width/config.Width),
+			})
+		}
+
+		if opts.ThumbnailWidth > 0 {
+			height := opts.ThumbnailHeight
+			if height <= 0 {
+				height = max(1, config.Height*opts.ThumbnailWidth/config.Width)
+			}
+
+			img.Thumbnail = &imageVariant{
+				Path:   variantPath(location.RelPath, "thumb"),
+				Width:  opts.ThumbnailWidth,
+				Height: height,
+				Crop:   opts.ThumbnailHeight > 0,
+			}
+		}
+
+		pb.images[location.RelPath] = img
+	}
+
+	return nil
+}
+
+// buildImages writes every variant of every image, reusing processed images from the cache where the
+// source and settings haven't changed. Images are turned the right way up for their EXIF orientation
+// before they are resized, as the variants are written without it.
+func (pb *PageBuilder) buildImages() error {
+	for _, img := range pb.images {
+		variants := img.Variants
+		if img.Thumbnail != nil {
+			variants = append(variants[:len(variants):len(variants)], *img.Thumbnail)
+		}
+
+		if len(variants) == 0 {
+			continue
+		}
+
+		source, err := fs.ReadFile(pb.fsys, img.Source.SrcPath)
+		if err != nil {
+			return fmt.Errorf("failed to read image %s: %w", img.Source.SrcPath, err)
+		}
+
+		var decoded image.Image
+		for _, variant := range variants {
+			content, ok := pb.cachedImage(source, variant)
+			if !ok {
+				if decoded == nil {
+					decoded, _, err = image.Decode(bytes.NewReader(source))
+					if err != nil {
+						return fmt.Errorf("failed to decode image %s: %w", img.Source.SrcPath, err)
+					}
+					decoded = orientImage(decoded, img.Orientation)
+				}
+
+				content, err = pb.processImage(decoded, variant)
+				if err != nil {
+					return fmt.Errorf("failed to process image %s: %w", img.Source.SrcPath, err)
+				}
+
+				pb.cacheImage(source, variant, content)
+			}
+
+			if err := pb.writeOutput(ManifestFile{Path: variant.Path, Source: img.Source.SrcPath}, content); err != nil {
+				return fmt.Errorf("failed to write image: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// imageCachePath returns where a variant of the source image is cached, keyed by a hash of the
+// source and everything which affects the output, or "" if images aren't cached.
+func (pb *PageBuilder) imageCachePath(source []byte, variant imageVariant) string {
+	cacheDir := pb.Opts.Images.CacheDir
+	if cacheDir == "" {
+		return ""
+	}
+
+	// variants were once made without turning images the right way up, so the orientation is part of
+	// the key to keep them from being reused
+	h := sha256.New()
+	h.Write(source)
+	fmt.Fprintf(h, "|%d|%d|%t|%d|oriented", variant.Width, variant.Height, variant.Crop, pb.Opts.Images.Quality)
+
+	return filepath.Join(cacheDir, hex.EncodeToString(h.Sum(nil))+strings.ToLower(path.Ext(variant.Path)))
+}
+
+func (pb *PageBuilder) cachedImage(source []byte, variant imageVariant) ([]byte, bool) {
+	cachePath := pb.imageCachePath(source, variant)
+	if cachePath == "" {
+		return nil, false
+	}
+
+	content, err := os.ReadFile(cachePath)
+	return content, err == nil
+}
+
+// cacheImage saves a processed image for later builds. Failing to cache isn't fatal, it just means the
+// image will be processed again next time.
+func (pb *PageBuilder) cacheImage(source []byte, variant imageVariant, content []byte) {
+	cachePath := pb.imageCachePath(source, variant)
+	if cachePath == "" {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), os.ModePerm); err != nil {
+		return
+	}
+
+	_ = os.WriteFile(cachePath, content, 0644)
+}
+
+// processImage resizes src to the size of variant and encodes it in the format of the variant's path.
+func (pb *PageBuilder) processImage(src image.Image, variant imageVariant) ([]byte, error) {
+	bounds := src.Bounds()
+	if variant.Crop {
+		bounds = cropToAspect(bounds, variant.Width, variant.Height)
+	}
+
+	resized := resizeImage(src, bounds, variant.Width, variant.Height)
+
+	buf := bytes.NewBuffer(nil)
+	switch strings.ToLower(path.Ext(variant.Path)) {
+	case ".png":
+		if err := png.Encode(buf, resized); err != nil {
+			return nil, err
+		}
+	default:
+		quality := pb.Opts.Images.Quality
+		if quality <= 0 {
+			quality = jpeg.DefaultQuality
+		}
+
+		if err := jpeg.Encode(buf, resized, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// cropToAspect returns the largest rectangle in the centre of bounds with the aspect ratio of width x height.
+func cropToAspect(bounds image.Rectangle, width, height int) image.Rectangle {
+	w, h := bounds.Dx(), bounds.Dy()
+	if w*height > h*width {
+		cropped := h * width / height
+		x := bounds.Min.X + (w-cropped)/2
+		return image.Rect(x, bounds.Min.Y, x+cropped, bounds.Max.Y)
+	}
+
+	cropped := w * height / width
+	y := bounds.Min.Y + (h-cropped)/2
+	return image.Rect(bounds.Min.X, y, bounds.Max.X, y+cropped)
+}
+
+// resizeImage scales the area of src within bounds down to width x height, averaging the source
+// pixels covered by each destination pixel.
+func resizeImage(src image.Image, bounds image.Rectangle, width, height int) *image.RGBA {
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+
+	sw, sh := rgba.Bounds().Dx(), rgba.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		sy0 := y * sh / height
+		sy1 := max(sy0+1, (y+1)*sh/height)
+
+		for x := 0; x < width; x++ {
+			sx0 := x * sw / width
+			sx1 := max(sx0+1, (x+1)*sw/width)
+
+			var r, g, b, a, n int
+			for sy := sy0; sy < sy1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride:]
+				for sx := sx0; sx < sx1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += int(p[0])
+					g += int(p[1])
+					b += int(p[2])
+					a += int(p[3])
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
+
+// imageSrcset returns the srcset of an image in static/, listing each of its resized variants and the
+// original.
+func (pb *PageBuilder) imageSrcset(name string) string {
+	name = "/" + strings.TrimPrefix(name, "/")
+
+	img, ok := pb.images[name]
+	if !ok {
+		return name
+	}
+
+	candidates := make([]string, 0, len(img.Variants)+1)
+	for _, variant := range img.Variants {
+		candidates = append(candidates, fmt.Sprintf("%s %dw", variant.Path, variant.Width))
+	}
+	candidates = append(candidates, fmt.Sprintf("%s %dw", name, img.Width))
+
+	return strings.Join(candidates, ", ")
+}
+
+// imageThumbnail returns the path of the thumbnail of an image in static/, or the image itself if it
+// has no thumbnail.
+func (pb *PageBuilder) imageThumbnail(name string) string {
+	name = "/" + strings.TrimPrefix(name, "/")
+
+	if img, ok := pb.images[name]; ok && img.Thumbnail != nil {
+		return img.Thumbnail.Path
+	}
+
+	return name
+}
+
+// imageTag returns a responsive <img> tag for an image in static/. sizes defaults to 100vw.
+func (pb *PageBuilder) imageTag(name, alt string, sizes ...string) template.HTML {
+	name = "/" + strings.TrimPrefix(name, "/")
+
+	attrs := fmt.Sprintf(`src="%s" alt="%s"`, template.HTMLEscapeString(name), template.HTMLEscapeString(alt))
+	if img, ok := pb.images[name]; ok {
+		s := "100vw"
+		if len(sizes) > 0 {
+			s = sizes[0]
+		}
+
+		attrs += fmt.Sprintf(` srcset="%s" sizes="%s" width="%d" height="%d"`,
+			template.HTMLEscapeString(pb.imageSrcset(name)), template.HTMLEscapeString(s), img.Width, img.Height)
+	}
+
+	return template.HTML("<img " + attrs + ">")
+}
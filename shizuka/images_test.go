@@ -0,0 +1,129 @@
+package shizuka
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"testing"
+	"testing/fstest"
+)
+
+// testPhoto returns a 4x2 jpeg, red on the left and blue on the right, tagged with an EXIF orientation.
+func testPhoto(t *testing.T, orientation int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= 2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a big-endian TIFF structure holding a single IFD with just the orientation
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112) // orientation
+	tiff = binary.BigEndian.AppendUint16(tiff, 3)      // a short
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)      // one of them
+	tiff = binary.BigEndian.AppendUint16(tiff, uint16(orientation))
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := binary.BigEndian.AppendUint16([]byte{0xFF, 0xE1}, uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	photo := buf.Bytes()
+	return append(append(append([]byte{}, photo[:2]...), app1...), photo[2:]...)
+}
+
+func TestOrientImage(t *testing.T) {
+	// a 2x1 image, red on the left and blue on the right
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, color.RGBA{R: 255, A: 255})
+	src.Set(1, 0, color.RGBA{B: 255, A: 255})
+
+	red := color.RGBA{R: 255, A: 255}
+
+	tests := []struct {
+		orientation int
+		width       int
+		height      int
+		redAt       image.Point
+	}{
+		{orientation: 1, width: 2, height: 1, redAt: image.Pt(0, 0)},
+		{orientation: 2, width: 2, height: 1, redAt: image.Pt(1, 0)},
+		{orientation: 3, width: 2, height: 1, redAt: image.Pt(1, 0)},
+		{orientation: 4, width: 2, height: 1, redAt: image.Pt(0, 0)},
+		{orientation: 5, width: 1, height: 2, redAt: image.Pt(0, 0)},
+		{orientation: 6, width: 1, height: 2, redAt: image.Pt(0, 0)},
+		{orientation: 7, width: 1, height: 2, redAt: image.Pt(0, 1)},
+		{orientation: 8, width: 1, height: 2, redAt: image.Pt(0, 1)},
+	}
+
+	for _, test := range tests {
+		got := orientImage(src, test.orientation)
+		if b := got.Bounds(); b.Dx() != test.width || b.Dy() != test.height {
+			t.Errorf("orientation %d: %dx%d, want %dx%d", test.orientation, b.Dx(), b.Dy(), test.width, test.height)
+			continue
+		}
+
+		if c := color.RGBAModel.Convert(got.At(test.redAt.X, test.redAt.Y)); c != red {
+			t.Errorf("orientation %d: %v at %v, want red", test.orientation, c, test.redAt)
+		}
+	}
+}
+
+func TestBuildImagesOrientation(t *testing.T) {
+	fsys := fstest.MapFS{
+		"templates/page.tmpl": {Data: []byte(`{{ img "/photo.jpg" "" }}`)},
+		"content/index.md":    {Data: []byte("---\ntemplate: \"page.tmpl\"\n---\n")},
+		"static/photo.jpg":    {Data: testPhoto(t, 6)},
+	}
+
+	out := NewMapOutput()
+	pb := NewPageBuilder(fsys, out)
+	pb.Opts.Images = ImageOpts{Widths: []int{1}, Quality: 100}
+
+	if err := pb.Index(); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	if err := pb.Build(); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	// the photo is shown turned a quarter clockwise, so is 2x4 with red at the top
+	want := `<img src="/photo.jpg" alt="" srcset="/photo.1w.jpg 1w, /photo.jpg 2w" sizes="100vw" width="2" height="4">`
+	if got := string(out.Files["index.html"]); got != want {
+		t.Errorf("index.html: %s, want %s", got, want)
+	}
+
+	variant, err := jpeg.Decode(bytes.NewReader(out.Files["photo.1w.jpg"]))
+	if err != nil {
+		t.Fatalf("failed to decode variant: %v", err)
+	}
+	if b := variant.Bounds(); b.Dx() != 1 || b.Dy() != 2 {
+		t.Fatalf("variant is %dx%d, want 1x2", b.Dx(), b.Dy())
+	}
+
+	top := color.RGBAModel.Convert(variant.At(0, 0)).(color.RGBA)
+	bottom := color.RGBAModel.Convert(variant.At(0, 1)).(color.RGBA)
+	if top.R < top.B || bottom.B < bottom.R {
+		t.Errorf("variant is %v over %v, want red over blue", top, bottom)
+	}
+
+	// without a cache directory, nothing is cached
+	if _, err := os.Stat(DefaultImageCacheDir); err == nil {
+		t.Errorf("images cached in %s without a cache directory set", DefaultImageCacheDir)
+	}
+}
@@ -0,0 +1,500 @@
+package shizuka
+
+import (
+	"fmt"
+	"github.com/charmbracelet/log"
+	"io/fs"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+	"text/template/parse"
+)
+
+// Dependencies of a rendered page, as recorded in PageBuilder.deps.
+const (
+	depContent  = "content:"  // the content file a page was built from
+	depTemplate = "template:" // a template used to render a page, including any it calls
+	depPageMap  = "pagemap"   // every page, for pages whose templates read .PageMap or .Taxonomies
+)
+
+// pageView is the other pages a page shows. Where it differs between indexes the page has to be
+// rendered again, whether the pages shown changed themselves or moved, e.g. when a sibling's new date
+// takes it elsewhere in its section.
+type pageView struct {
+	Parent       *Lite
+	Ancestors    []Lite
+	Children     []Lite
+	Related      []Lite
+	Translations []Lite
+	Prev, Next   *Lite
+	Paginators   []Paginator
+}
+
+// cachedPage is a parsed content file, reused by later indexes for as long as the file is unchanged.
+type cachedPage struct {
+	size    int64
+	modTime int64
+	parsed  parsedPage
+}
+
+// templateInfo is what a template depends on, found from its parse tree.
+type templateInfo struct {
+	source  string          // the parsed template, which changes whenever the template does
+	calls   map[string]bool // the templates it calls
+	pageMap bool            // whether it reads .PageMap or .Taxonomies, which show every page
+}
+
+// cachedParse returns the parsed form of a content file from an earlier index, if it hasn't changed.
+func (pb *PageBuilder) cachedParse(file Location) (parsedPage, bool) {
+	pb.mu.Lock()
+	cached, ok := pb.parseCache[file.SrcPath]
+	pb.mu.Unlock()
+
+	if !ok {
+		return parsedPage{}, false
+	}
+
+	info, err := fs.Stat(pb.src, file.SrcPath)
+	if err != nil || info.Size() != cached.size || info.ModTime().UnixNano() != cached.modTime {
+		return parsedPage{}, false
+	}
+
+	cached.parsed.file = file
+	return cached.parsed, true
+}
+
+// cacheParse saves the parsed form of a content file for later indexes. info must be taken before the
+// file was read, so that a change made while it was being parsed isn't missed.
+func (pb *PageBuilder) cacheParse(parsed parsedPage, info fs.FileInfo) {
+	// without a modification time there's no telling when the file changes
+	if parsed.err != nil || info.ModTime().IsZero() {
+		return
+	}
+
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	pb.parseCache[parsed.file.SrcPath] = cachedPage{
+		size:    info.Size(),
+		modTime: info.ModTime().UnixNano(),
+		parsed:  parsed,
+	}
+}
+
+// walkTemplate calls fn for node and every node below it.
+func walkTemplate(node parse.Node, fn func(parse.Node)) {
+	if reflect.ValueOf(node).IsNil() {
+		return
+	}
+
+	fn(node)
+
+	switch n := node.(type) {
+	case *parse.ListNode:
+		for _, child := range n.Nodes {
+			walkTemplate(child, fn)
+		}
+	case *parse.ActionNode:
+		walkTemplate(n.Pipe, fn)
+	case *parse.PipeNode:
+		for _, cmd := range n.Cmds {
+			walkTemplate(cmd, fn)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			walkTemplate(arg, fn)
+		}
+	case *parse.ChainNode:
+		walkTemplate(n.Node, fn)
+	case *parse.TemplateNode:
+		walkTemplate(n.Pipe, fn)
+	case *parse.IfNode:
+		walkTemplate(n.Pipe, fn)
+		walkTemplate(n.List, fn)
+		walkTemplate(n.ElseList, fn)
+	case *parse.RangeNode:
+		walkTemplate(n.Pipe, fn)
+		walkTemplate(n.List, fn)
+		walkTemplate(n.ElseList, fn)
+	case *parse.WithNode:
+		walkTemplate(n.Pipe, fn)
+		walkTemplate(n.List, fn)
+		walkTemplate(n.ElseList, fn)
+	}
+}
+
+// analyseTemplate finds what the template parsed as tree depends on.
+func analyseTemplate(tree *parse.Tree) templateInfo {
+	info := templateInfo{
+		source: tree.Root.String(),
+		calls:  make(map[string]bool),
+	}
+
+	showsAll := func(idents []string) bool {
+		return slices.Contains(idents, "PageMap") || slices.Contains(idents, "Taxonomies")
+	}
+
+	walkTemplate(tree.Root, func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.TemplateNode:
+			info.calls[n.Name] = true
+		case *parse.FieldNode:
+			info.pageMap = info.pageMap || showsAll(n.Ident)
+		case *parse.VariableNode:
+			info.pageMap = info.pageMap || showsAll(n.Ident)
+		case *parse.ChainNode:
+			info.pageMap = info.pageMap || showsAll(n.Field)
+		}
+	})
+
+	return info
+}
+
+// indexTemplateInfo analyses every template. It must be called before any template is executed, as
+// executing an html template rewrites its parse tree.
+func (pb *PageBuilder) indexTemplateInfo() {
+	pb.templateInfo = make(map[string]templateInfo)
+
+	for _, t := range pb.textTemplates.Templates() {
+		if t.Tree != nil {
+			pb.templateInfo[t.Name()] = analyseTemplate(t.Tree)
+		}
+	}
+
+	// html templates are looked up first, so take precedence over text templates of the same name
+	for _, t := range pb.templates.Templates() {
+		if t.Tree != nil {
+			pb.templateInfo[t.Name()] = analyseTemplate(t.Tree)
+		}
+	}
+}
+
+// templateClosure returns the template called name along with every template it calls, directly or
+// not, and whether any of them show every page.
+func (pb *PageBuilder) templateClosure(name string) ([]string, bool) {
+	seen := map[string]bool{name: true}
+	queue := []string{name}
+	pageMap := false
+
+	for len(queue) > 0 {
+		info := pb.templateInfo[queue[0]]
+		queue = queue[1:]
+
+		pageMap = pageMap || info.pageMap
+		for call := range info.calls {
+			if !seen[call] {
+				seen[call] = true
+				queue = append(queue, call)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+
+	return names, pageMap
+}
+
+// indexDeps records what every page depends on: its content file, the templates it's rendered
+// with, and the other pages it shows.
+func (pb *PageBuilder) indexDeps() {
+	pb.deps = make(map[string]map[string]bool, len(pb.pages))
+	pb.views = make(map[string]pageView, len(pb.pages))
+
+	for relPath, page := range pb.pages {
+		deps := make(map[string]bool)
+		if page.Location.SrcPath != "" {
+			deps[depContent+page.Location.SrcPath] = true
+		}
+
+		for _, format := range page.Outputs {
+			names, pageMap := pb.templateClosure(formatTemplate(page.Template, format))
+			for _, name := range names {
+				deps[depTemplate+name] = true
+			}
+			if pageMap {
+				deps[depPageMap] = true
+			}
+		}
+
+		prev, next := pb.siblings(relPath)
+		view := pageView{
+			Parent:       pb.lite(pb.parentOf(relPath)),
+			Ancestors:    pb.ancestors(relPath),
+			Children:     pb.pageMap[relPath],
+			Related:      pb.related[relPath],
+			Translations: pb.pageTranslations(page),
+			Prev:         prev,
+			Next:         next,
+		}
+		for _, paginator := range pb.paginators[relPath] {
+			view.Paginators = append(view.Paginators, *paginator)
+		}
+
+		pb.deps[relPath] = deps
+		pb.views[relPath] = view
+	}
+}
+
+// siteShape is what a build produces, other than the content of each page. Where it changes between
+// builds files are added or removed, so the site has to be built in full.
+func (pb *PageBuilder) siteShape() map[string]string {
+	shape := make(map[string]string, len(pb.pages))
+
+	for relPath, page := range pb.pages {
+		outputs := make([]string, len(page.Outputs))
+		for i, format := range page.Outputs {
+			outputs[i] = format.Name
+		}
+
+		shape[relPath] = fmt.Sprint(outputs, len(pb.paginators[relPath]), page.PaginatePath)
+	}
+
+	for _, taxonomies := range pb.taxonomies {
+		for _, taxonomy := range taxonomies {
+			for _, term := range taxonomy.Terms {
+				shape[term.Path] = "term"
+			}
+		}
+	}
+
+	// pages can pick up copies of the files they link to
+	for _, bundle := range pb.bundles {
+		shape[bundle.DstPath] = bundle.SrcPath
+	}
+
+	return shape
+}
+
+// changeKind sorts a changed file into how much of the site it affects.
+type changeKind int
+
+const (
+	changeIgnored  changeKind = iota // a file the site isn't built from
+	changeContent                    // a markdown file in content/
+	changeTemplate                   // a template
+	changeStatic                     // an existing static file, which can just be copied again
+	changeFull                       // anything else, which needs the whole site rebuilt
+)
+
+// classifyChange works out what kind of file changed at name, a path within the source.
+func (pb *PageBuilder) classifyChange(name string) changeKind {
+	if strings.HasSuffix(name, "~") {
+		return changeIgnored
+	}
+
+	_, err := fs.Stat(pb.fsys, name)
+	exists := err == nil
+
+	// editors often write to a temporary file and rename it over the original, so files which have
+	// come and gone without ever being indexed can be ignored
+	if !exists && !pb.isSource(name) {
+		return changeIgnored
+	}
+
+	dir, _, _ := strings.Cut(name, "/")
+	switch {
+	case dir == "content" && path.Ext(name) == ".md":
+		if !exists {
+			return changeFull // removed
+		}
+		return changeContent
+	case dir == "templates" && path.Ext(name) == ".tmpl":
+		return changeTemplate
+	case dir == "static":
+		if !exists {
+			return changeFull // removed
+		}
+
+		// files processed by the asset pipeline or resized aren't in pb.static as they are
+		for _, location := range pb.static {
+			if location.SrcPath == name && pb.images[location.RelPath] == nil {
+				return changeStatic
+			}
+		}
+		return changeFull
+	case dir == "content" || dir == "data":
+		return changeFull
+	}
+
+	return changeIgnored
+}
+
+// isSource reports whether the file at name was used by the last index.
+func (pb *PageBuilder) isSource(name string) bool {
+	for _, locations := range [][]Location{pb.content, pb.static} {
+		for _, location := range locations {
+			if location.SrcPath == name {
+				return true
+			}
+		}
+	}
+
+	for _, templateFile := range pb.templateFiles {
+		if templateFile == name {
+			return true
+		}
+	}
+
+	// data files aren't recorded individually, so any that are removed must be assumed to matter
+	return strings.HasPrefix(name, "data/")
+}
+
+// Rebuild updates the output after the files at paths have changed, keeping the page builder between
+// builds. paths are slash-separated paths within the source, or within a theme for theme files. Edits
+// to existing content, templates and static files only re-render the pages which depend on them, or
+// whose parent, children, neighbours, related pages, translations or paginated items have changed,
+// writing over the existing output. Files are only found again when one is added, and templates only
+// parsed again when one has changed. Anything which changes the shape of the site, such as adding or
+// removing pages, and changes to data or other files, rebuild the whole site as Build does, though
+// unchanged markdown isn't converted again.
+func (pb *PageBuilder) Rebuild(paths []string) error {
+	kinds := make(map[changeKind][]string)
+	for _, p := range paths {
+		p = path.Clean(p)
+		kind := pb.classifyChange(p)
+		kinds[kind] = append(kinds[kind], p)
+	}
+
+	if len(kinds[changeFull]) > 0 || !pb.built {
+		return pb.fullRebuild()
+	}
+
+	if len(kinds[changeContent]) == 0 && len(kinds[changeTemplate]) == 0 && len(kinds[changeStatic]) == 0 {
+		return nil
+	}
+
+	// the files of the site only need finding again if one has been added, and the templates only
+	// need parsing again if one has changed
+	keep := indexKeep{files: true, templates: len(kinds[changeTemplate]) == 0}
+	for _, p := range kinds[changeContent] {
+		keep.files = keep.files && pb.isSource(p)
+	}
+
+	oldPages := pb.pages
+	oldInfo := pb.templateInfo
+	oldViews := pb.views
+	oldShape := pb.siteShape()
+
+	if err := pb.index(keep); err != nil {
+		pb.built = false
+		return fmt.Errorf("Rebuild: %w", err)
+	}
+
+	if !reflect.DeepEqual(oldShape, pb.siteShape()) {
+		log.Debug("site shape changed, rebuilding everything")
+		return pb.Build()
+	}
+
+	// work out which dependencies have changed
+	changed := make(map[string]bool)
+	for _, p := range kinds[changeContent] {
+		changed[depContent+p] = true
+	}
+
+	for name, info := range pb.templateInfo {
+		if old, ok := oldInfo[name]; !ok || old.source != info.source {
+			changed[depTemplate+name] = true
+		}
+	}
+	for name := range oldInfo {
+		if _, ok := pb.templateInfo[name]; !ok {
+			changed[depTemplate+name] = true
+		}
+	}
+
+	for relPath, page := range pb.pages {
+		if !reflect.DeepEqual(oldPages[relPath].Lite(), page.Lite()) {
+			changed[depPageMap] = true
+			break
+		}
+	}
+
+	affected := make([]string, 0)
+	for relPath, deps := range pb.deps {
+		if !reflect.DeepEqual(oldViews[relPath], pb.views[relPath]) {
+			affected = append(affected, relPath)
+			continue
+		}
+
+		for dep := range deps {
+			if changed[dep] {
+				affected = append(affected, relPath)
+				break
+			}
+		}
+	}
+	slices.Sort(affected)
+
+	return pb.rebuildPages(affected, kinds[changeStatic])
+}
+
+// fullRebuild indexes and builds the whole site again.
+func (pb *PageBuilder) fullRebuild() error {
+	if err := pb.Index(); err != nil {
+		pb.built = false
+		return fmt.Errorf("Rebuild: %w", err)
+	}
+
+	return pb.Build()
+}
+
+// rebuildPages re-renders the pages at relPaths and copies the static files at staticPaths over the
+// existing output, along with the pages and files every build writes.
+func (pb *PageBuilder) rebuildPages(relPaths []string, staticPaths []string) (err error) {
+	if err := pb.out.Begin(false); err != nil {
+		_ = pb.out.Abort()
+		return fmt.Errorf("Rebuild: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = pb.out.Abort()
+		} else if commitErr := pb.out.Commit(); commitErr != nil {
+			pb.built = false
+			err = fmt.Errorf("Rebuild: failed to write output: %w", commitErr)
+		}
+	}()
+
+	pb.minified = minifyStats{}
+	pb.errors = make([]*RenderError, 0)
+
+	log.Debug("rebuilding pages", "pages", relPaths, "static", staticPaths)
+
+	for _, location := range pb.static {
+		if !slices.Contains(staticPaths, location.SrcPath) {
+			continue
+		}
+
+		if err := pb.replicateStaticFile(location); err != nil {
+			return fmt.Errorf("Rebuild: %w", err)
+		}
+	}
+
+	err = pb.parallel(len(relPaths), func(i int) error {
+		return pb.buildPage(pb.pages[relPaths[i]])
+	})
+	if err != nil {
+		return fmt.Errorf("Rebuild: %w", err)
+	}
+
+	if err := pb.buildShared(); err != nil {
+		return fmt.Errorf("Rebuild: %w", err)
+	}
+
+	pb.logMinified()
+
+	if err := pb.renderErrors(); err != nil {
+		// the pages which failed weren't written, so the next rebuild starts from scratch
+		pb.built = false
+		return err
+	}
+
+	if err := pb.finishBuild(); err != nil {
+		return fmt.Errorf("Rebuild: %w", err)
+	}
+
+	return nil
+}
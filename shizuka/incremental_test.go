@@ -0,0 +1,154 @@
+package shizuka
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+const testPostTemplate = `{{ .Title }}
+prev: {{ with .Prev }}{{ .Title }}{{ end }}
+next: {{ with .Next }}{{ .Title }}{{ end }}
+related: {{ range .Related }}{{ .Title }} {{ end }}
+translations: {{ range .Translations }}{{ .Lang }}={{ .Title }} {{ end }}
+{{ .Content }}`
+
+const testListTemplate = `{{ .Title }}
+children: {{ range .Children }}{{ .Title }} {{ end }}
+items: {{ with .Paginator }}{{ range .Items }}{{ .Title }} {{ end }}{{ end }}`
+
+// testSite is a small site with a paginated home page listing a section of posts, some of which
+// are translated, whose posts show their neighbours, related posts and translations.
+func testSite() fstest.MapFS {
+	fsys := fstest.MapFS{
+		"templates/post.tmpl":    {Data: []byte(testPostTemplate)},
+		"templates/section.tmpl": {Data: []byte(testListTemplate)},
+		"content/index.md": {Data: []byte(`---
+title: "Home"
+template: "section.tmpl"
+paginate: 2
+paginate_path: "/posts"
+---
+`)},
+		"content/posts/index.md": {Data: []byte(`---
+title: "Posts"
+template: "section.tmpl"
+---
+`)},
+		"content/posts/a.md":    {Data: []byte(testPost("A", "2024-01-01", "go"))},
+		"content/posts/b.md":    {Data: []byte(testPost("B", "2024-01-02", "go"))},
+		"content/posts/c.md":    {Data: []byte(testPost("C", "2024-01-03", "web"))},
+		"content/posts/d.md":    {Data: []byte(testPost("D", "2024-01-04", "web"))},
+		"content/posts/a.ja.md": {Data: []byte(testPost("A (ja)", "2024-01-01", "go"))},
+	}
+
+	for _, file := range fsys {
+		file.ModTime = time.Unix(0, 0)
+	}
+
+	return fsys
+}
+
+func testPost(title, date, tag string) string {
+	return "---\ntitle: \"" + title + "\"\ndate: \"" + date + "\"\ntemplate: \"post.tmpl\"\ntags: [\"" + tag + "\"]\n---\n\n" + title + "\n"
+}
+
+func testOpts() BuildOpts {
+	return BuildOpts{
+		BuildTime: time.Unix(0, 0),
+		Languages: Languages{
+			Default: "en",
+			List: []Language{
+				{Code: "en", Name: "English"},
+				{Code: "ja", Name: "日本語", Prefix: "/ja"},
+			},
+		},
+		Related: RelatedOpts{Count: 1, TagWeight: 1},
+	}
+}
+
+// buildSite builds the site in fsys from scratch, returning its output.
+func buildSite(t *testing.T, fsys fstest.MapFS) map[string][]byte {
+	t.Helper()
+
+	out := NewMapOutput()
+	pb := NewPageBuilder(fsys, out)
+	pb.Opts = testOpts()
+
+	if err := pb.Index(); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	if err := pb.Build(); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	return out.Files
+}
+
+func TestRebuildMatchesBuild(t *testing.T) {
+	tests := []struct {
+		name  string
+		edits map[string]string
+	}{
+		{
+			// moves a from the end of the section to the start, changing the neighbours of b and d
+			// and the items on each page of the home page, without changing those pages' own deps
+			name:  "date",
+			edits: map[string]string{"content/posts/a.md": testPost("A", "2024-01-05", "go")},
+		},
+		{
+			// b is no longer related to a, but is to c and d
+			name:  "related",
+			edits: map[string]string{"content/posts/b.md": testPost("B", "2024-01-02", "web")},
+		},
+		{
+			name:  "translation",
+			edits: map[string]string{"content/posts/a.ja.md": testPost("A (日本語)", "2024-01-01", "go")},
+		},
+		{
+			name:  "template",
+			edits: map[string]string{"templates/post.tmpl": "{{ .Title }}: {{ with .Next }}{{ .Title }}{{ end }}"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fsys := testSite()
+
+			out := NewMapOutput()
+			pb := NewPageBuilder(fsys, out)
+			pb.Opts = testOpts()
+
+			if err := pb.Index(); err != nil {
+				t.Fatalf("Index: %v", err)
+			}
+			if err := pb.Build(); err != nil {
+				t.Fatalf("Build: %v", err)
+			}
+
+			for name, content := range test.edits {
+				fsys[name] = &fstest.MapFile{Data: []byte(content), ModTime: time.Unix(1, 0)}
+			}
+
+			if err := pb.Rebuild(slices.Collect(maps.Keys(test.edits))); err != nil {
+				t.Fatalf("Rebuild: %v", err)
+			}
+
+			want := buildSite(t, fsys)
+			for _, name := range slices.Sorted(maps.Keys(want)) {
+				if got, ok := out.Files[name]; !ok {
+					t.Errorf("%s: missing after rebuild", name)
+				} else if string(got) != string(want[name]) {
+					t.Errorf("%s: after rebuild\n%s\nwant\n%s", name, got, want[name])
+				}
+			}
+			for name := range out.Files {
+				if _, ok := want[name]; !ok {
+					t.Errorf("%s: left over after rebuild", name)
+				}
+			}
+		})
+	}
+}
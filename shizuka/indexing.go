@@ -4,13 +4,16 @@ import (
 	"fmt"
 	"html/template"
 	"io/fs"
-	"path/filepath"
+	"path"
+	"slices"
+	texttemplate "text/template"
 )
 
-func walk(root string) (files []string, dirs []string, err error) {
+// walk lists the files and directories below root in fsys. A missing root is treated as empty.
+func walk(fsys fs.FS, root string) (files []string, dirs []string, err error) {
 	files = make([]string, 0)
 	dirs = make([]string, 0)
-	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+	err = fs.WalkDir(fsys, root, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return nil
 		}
@@ -29,52 +32,115 @@ func walk(root string) (files []string, dirs []string, err error) {
 	return files, dirs, nil
 }
 
-// this function is horrible, apologies to everyone who has to look at it
-func index(src, dst string) (dirs, content, static []Location, templates *template.Template, err error) {
-	contentRoot := filepath.Join(src, "content")
-	staticRoot := filepath.Join(src, "static")
-	templatesRoot := filepath.Join(src, "templates")
+// siteIndex is the files found in the source directory and its themes.
+type siteIndex struct {
+	dirs      []Location
+	content   []Location
+	static    []Location
+	data      map[string]any
+	dataFiles map[string]string // the file each key of data was loaded from, e.g. "authors/jane" from "data/authors/jane.yaml"
+}
+
+// index finds the content, static files and data of the site in fsys. Where the site has themes,
+// fsys layers the site over them, so files in the site override same-named files in a theme.
+// Content is only read from src, the site itself.
+func index(fsys, src fs.FS, languages Languages) (*siteIndex, error) {
+	const contentRoot, staticRoot = "content", "static"
 
 	// Index content
-	srcContentFiles, srcContentDirs, err := walk(contentRoot)
+	srcContentFiles, _, err := walk(src, contentRoot)
 	if err != nil {
-		return nil, nil, nil, nil, fmt.Errorf("index: failed to index content: %w", err)
+		return nil, fmt.Errorf("index: failed to index content: %w", err)
 	}
 
-	contentDirs, err := MakeLocations(contentRoot, dst, srcContentDirs)
+	contentFiles, _, err := MakeContentLocations(contentRoot, "/", srcContentFiles, languages)
 	if err != nil {
-		return nil, nil, nil, nil, fmt.Errorf("index: failed to find dir paths: %w", err)
+		return nil, fmt.Errorf("index: failed to find file paths: %w", err)
 	}
 
-	contentFiles, contentIndexDirs, err := MakeContentLocations(contentRoot, dst, srcContentFiles)
-	if err != nil {
-		return nil, nil, nil, nil, fmt.Errorf("index: failed to find file paths: %w", err)
+	// content directories are found from where files are written rather than where they are read
+	// from, as the language of a file can move it to a different directory
+	contentDirs := make([]Location, len(contentFiles))
+	for i, file := range contentFiles {
+		contentDirs[i] = Location{DstPath: path.Dir(file.DstPath)}
 	}
 
-	srcStaticFiles, srcStaticDirs, err := walk(staticRoot)
+	srcStaticFiles, srcStaticDirs, err := walk(fsys, staticRoot)
 	if err != nil {
-		return nil, nil, nil, nil, fmt.Errorf("index: failed to index static files: %w", err)
+		return nil, fmt.Errorf("index: failed to index static files: %w", err)
 	}
 
-	staticFiles, err := MakeLocations(staticRoot, dst, srcStaticFiles)
+	staticFiles, err := MakeLocations(staticRoot, "/", srcStaticFiles)
 	if err != nil {
-		return nil, nil, nil, nil, fmt.Errorf("index: failed to find static file paths: %w", err)
+		return nil, fmt.Errorf("index: failed to find static file paths: %w", err)
 	}
 
-	staticDirs, err := MakeLocations(staticRoot, dst, srcStaticDirs)
+	staticDirs, err := MakeLocations(staticRoot, "/", srcStaticDirs)
 	if err != nil {
-		return nil, nil, nil, nil, fmt.Errorf("index: failed to find dir paths: %w", err)
+		return nil, fmt.Errorf("index: failed to find dir paths: %w", err)
 	}
 
-	dirs = locationsUnion(contentDirs, contentIndexDirs, staticDirs)
+	dirs := locationsUnion(contentDirs, staticDirs)
 	if conflicts := locationsIntersect(contentFiles, staticFiles); len(conflicts) > 0 {
-		return nil, nil, nil, nil, fmt.Errorf("index: conflicts found between static files and content: %v", conflicts)
+		return nil, fmt.Errorf("index: conflicts found between static files and content: %v", conflicts)
+	}
+
+	data, dataFiles, err := indexData(fsys)
+	if err != nil {
+		return nil, fmt.Errorf("index: failed to load data: %w", err)
 	}
 
-	templates, err = template.ParseGlob(filepath.Join(templatesRoot, "*.tmpl"))
+	return &siteIndex{
+		dirs:      dirs,
+		content:   contentFiles,
+		static:    staticFiles,
+		data:      data,
+		dataFiles: dataFiles,
+	}, nil
+}
+
+// indexTemplates parses the templates in fsys. HTML templates are parsed with html/template, and
+// templates for any other format (post.json.tmpl, post.txt.tmpl) with text/template. It also returns
+// the file each template was parsed from.
+func indexTemplates(fsys fs.FS, funcs template.FuncMap) (*template.Template, *texttemplate.Template, map[string]string, error) {
+	matches, err := fs.Glob(fsys, "templates/*.tmpl")
 	if err != nil {
-		return nil, nil, nil, nil, fmt.Errorf("index: failed to parse templates: %w", err)
+		return nil, nil, nil, err
+	}
+
+	files := make(map[string]string)
+	for _, match := range matches {
+		files[path.Base(match)] = match
+	}
+
+	htmlPaths := make([]string, 0, len(files))
+	textPaths := make([]string, 0)
+	for _, p := range files {
+		if isHTMLTemplate(p) {
+			htmlPaths = append(htmlPaths, p)
+		} else {
+			textPaths = append(textPaths, p)
+		}
+	}
+	slices.Sort(htmlPaths)
+	slices.Sort(textPaths)
+
+	if len(htmlPaths) == 0 {
+		return nil, nil, nil, fmt.Errorf("no templates found")
+	}
+
+	templates, err := template.New("").Funcs(funcs).ParseFS(fsys, htmlPaths...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	textTemplates := texttemplate.New("").Funcs(texttemplate.FuncMap(funcs))
+	if len(textPaths) > 0 {
+		textTemplates, err = textTemplates.ParseFS(fsys, textPaths...)
+		if err != nil {
+			return nil, nil, nil, err
+		}
 	}
 
-	return dirs, contentFiles, staticFiles, templates, err
+	return templates, textTemplates, files, nil
 }
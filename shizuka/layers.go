@@ -0,0 +1,70 @@
+package shizuka
+
+import (
+	"errors"
+	"io/fs"
+	"slices"
+	"strings"
+)
+
+// layeredFS combines a site with its themes, so that templates, static files and data in the site
+// replace those with the same path in a theme. layers are ordered from highest to lowest precedence.
+type layeredFS struct {
+	layers []fs.FS
+}
+
+// Open opens name from the highest precedence layer which has it.
+func (l layeredFS) Open(name string) (fs.File, error) {
+	var firstErr error
+	for _, layer := range l.layers {
+		file, err := layer.Open(name)
+		if err == nil {
+			return file, nil
+		}
+
+		if firstErr == nil || !errors.Is(err, fs.ErrNotExist) {
+			firstErr = err
+		}
+	}
+
+	if firstErr == nil {
+		firstErr = &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return nil, firstErr
+}
+
+// ReadDir lists the directory name in every layer, with each entry taken from the highest precedence
+// layer which has it.
+func (l layeredFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries := make(map[string]fs.DirEntry)
+	found := false
+
+	for i := len(l.layers) - 1; i >= 0; i-- {
+		layerEntries, err := fs.ReadDir(l.layers[i], name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		found = true
+		for _, entry := range layerEntries {
+			entries[entry.Name()] = entry
+		}
+	}
+
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	result := make([]fs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, entry)
+	}
+	slices.SortFunc(result, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+
+	return result, nil
+}
@@ -2,25 +2,50 @@ package shizuka
 
 import (
 	"fmt"
-	"path/filepath"
+	"path"
 	"strings"
 )
 
+// NotFoundPath is where content/404.md is rendered to, so that hosts can find it.
+const NotFoundPath = "/404.html"
+
+// Location is where a file is read from and written to. SrcPath is a path within the source fs.FS,
+// DstPath is the path it's written to in the output, and RelPath is the URL path of the page.
 type Location struct {
 	SrcPath string
 	DstPath string
 	RelPath string
+	Lang    string
+}
+
+// isNotFound reports whether relPath is the not found page of any language.
+func isNotFound(relPath string) bool {
+	return path.Base(relPath) == path.Base(NotFoundPath)
+}
+
+// relativePath returns the slash-separated path of srcPath within srcRoot, starting with a slash.
+func relativePath(srcRoot, srcPath string) (string, error) {
+	if srcPath == srcRoot {
+		return "/", nil
+	}
+
+	relPath, ok := strings.CutPrefix(srcPath, strings.TrimSuffix(srcRoot, "/")+"/")
+	if !ok {
+		return "", fmt.Errorf("%s is not in %s", srcPath, srcRoot)
+	}
+
+	return "/" + relPath, nil
 }
 
+// NewLocation finds where a file at srcPath within srcRoot is written to. Source paths are paths
+// within the source fs.FS, and destination paths are rooted at dstRoot, both separated by slashes.
 func NewLocation(srcRoot, dstRoot, srcPath string) (*Location, error) {
-	relPath, err := filepath.Rel(srcRoot, srcPath)
+	relPath, err := relativePath(srcRoot, srcPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to calculate relative path: %w", err)
 	}
 
-	relPath = "/" + filepath.ToSlash(relPath)
-
-	dstPath := filepath.Join(dstRoot, relPath)
+	dstPath := path.Join(dstRoot, relPath)
 
 	return &Location{
 		SrcPath: srcPath,
@@ -29,47 +54,64 @@ func NewLocation(srcRoot, dstRoot, srcPath string) (*Location, error) {
 	}, nil
 }
 
-func ContentLocation(srcRoot, dstRoot, srcPath string) (*Location, string, error) {
-	relPath, err := filepath.Rel(srcRoot, srcPath)
+// ContentLocation finds where a content file is rendered to. The language of the file is read from its
+// path, and removed in favour of the language's URL prefix.
+func ContentLocation(srcRoot, dstRoot, srcPath string, languages Languages) (*Location, string, error) {
+	relPath, err := relativePath(srcRoot, srcPath)
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to calculate relative path: %w", err)
 	}
 
-	relPath = "/" + filepath.ToSlash(relPath)
+	lang, relPath := languages.Split(relPath)
+	prefix := languages.Prefix(lang)
+
+	ext := path.Ext(srcPath)
+	if relPath == "/404.md" {
+		return &Location{
+			SrcPath: srcPath,
+			DstPath: path.Join(dstRoot, prefix+NotFoundPath),
+			RelPath: prefix + NotFoundPath,
+			Lang:    lang,
+		}, "", nil
+	}
+
+	relPath = prefix + relPath
 
-	ext := filepath.Ext(srcPath)
 	if ext == ".md" {
-		if filepath.Base(srcPath) == "index.md" {
+		if path.Base(relPath) == "index.md" {
 			relPath = strings.TrimSuffix(relPath, ".md")
-			dstPath := filepath.Join(dstRoot, relPath) + ".html"
-			relPath = filepath.Dir(relPath)
+			dstPath := path.Join(dstRoot, relPath) + ".html"
+			relPath = path.Dir(relPath)
 
 			return &Location{
 				SrcPath: srcPath,
 				DstPath: dstPath,
 				RelPath: relPath,
+				Lang:    lang,
 			}, "", nil
 		} else {
 			relPath = strings.TrimSuffix(relPath, ext)
-			dirPath := filepath.Join(dstRoot, relPath)
-			dstPath := filepath.Join(dirPath, "index.html") // Use .html for output
+			dirPath := path.Join(dstRoot, relPath)
+			dstPath := path.Join(dirPath, "index.html") // Use .html for output
 
 			return &Location{
 				SrcPath: srcPath,
 				DstPath: dstPath,
 				RelPath: relPath,
+				Lang:    lang,
 			}, dirPath, nil
 		}
 
 	}
 
 	// Non-Markdown files: keep original extension
-	dstPath := filepath.Join(dstRoot, relPath)
+	dstPath := path.Join(dstRoot, relPath)
 
 	return &Location{
 		SrcPath: srcPath,
 		DstPath: dstPath,
 		RelPath: relPath,
+		Lang:    lang,
 	}, "", nil
 }
 
@@ -88,12 +130,12 @@ func MakeLocations(srcRoot, dstRoot string, srcPaths []string) (locations []Loca
 	return locations, nil
 }
 
-func MakeContentLocations(srcRoot, dstRoot string, srcPaths []string) (locations []Location, dirs []Location, err error) {
+func MakeContentLocations(srcRoot, dstRoot string, srcPaths []string, languages Languages) (locations []Location, dirs []Location, err error) {
 	locations = make([]Location, len(srcPaths))
 	dirs = make([]Location, 0, len(srcPaths))
 
 	for i, path := range srcPaths {
-		loc, dir, err := ContentLocation(srcRoot, dstRoot, path)
+		loc, dir, err := ContentLocation(srcRoot, dstRoot, path, languages)
 		if err != nil {
 			return nil, nil, err
 		}
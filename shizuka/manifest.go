@@ -0,0 +1,105 @@
+package shizuka
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/charmbracelet/log"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ManifestPath is where the build manifest is written when BuildOpts.Manifest is set.
+const ManifestPath = "/build-manifest.json"
+
+// Manifest describes everything a build wrote.
+type Manifest struct {
+	Files    []ManifestFile `json:"files"`    // every file in the output, sorted by path
+	Warnings []string       `json:"warnings"` // problems which didn't stop the site from building, sorted
+}
+
+// ManifestFile describes a single file in the output.
+type ManifestFile struct {
+	Path       string        `json:"path"`                     // the path within the output, e.g. "posts/1/index.html"
+	Source     string        `json:"source,omitempty"`         // the source file it was built or copied from, if any
+	Template   string        `json:"template,omitempty"`       // the template it was rendered with, if any
+	Size       int           `json:"size"`                     // its size in bytes
+	Hash       string        `json:"hash"`                     // the hex encoded SHA-256 of its content
+	RenderTime time.Duration `json:"render_time_ns,omitempty"` // how long the template took to execute
+}
+
+// writeOutput writes content to the output at file.Path, recording it in the manifest.
+func (pb *PageBuilder) writeOutput(file ManifestFile, content []byte) error {
+	file.Path = outputName(file.Path)
+	if err := pb.out.WriteFile(file.Path, content); err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(content)
+	file.Size = len(content)
+	file.Hash = hex.EncodeToString(sum[:])
+
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	if pb.manifest == nil {
+		pb.manifest = make(map[string]ManifestFile)
+	}
+	pb.manifest[file.Path] = file
+
+	return nil
+}
+
+// warn logs a problem which doesn't stop the site from building, recording it for the manifest.
+func (pb *PageBuilder) warn(msg string, keyvals ...any) {
+	log.Warn(msg, keyvals...)
+
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		fmt.Fprintf(&b, " %v=%v", keyvals[i], keyvals[i+1])
+	}
+
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	pb.warnings = append(pb.warnings, b.String())
+}
+
+// Manifest returns what the last build wrote. After Rebuild, files which weren't written again are
+// listed as they were last written.
+func (pb *PageBuilder) Manifest() *Manifest {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	files := slices.SortedFunc(maps.Values(pb.manifest), func(a, b ManifestFile) int {
+		return cmp.Compare(a.Path, b.Path)
+	})
+
+	// warnings are found in parallel, so are sorted to keep the manifest the same between builds
+	warnings := append([]string{}, pb.warnings...)
+	slices.Sort(warnings)
+
+	return &Manifest{
+		Files:    append([]ManifestFile{}, files...),
+		Warnings: warnings,
+	}
+}
+
+// writeManifest writes the build manifest to the output, if configured to. It isn't listed in itself.
+func (pb *PageBuilder) writeManifest() error {
+	if !pb.Opts.Manifest {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(pb.Manifest(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode build manifest: %w", err)
+	}
+
+	return pb.out.WriteFile(outputName(ManifestPath), content)
+}
@@ -0,0 +1,430 @@
+package shizuka
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/charmbracelet/log"
+	"path"
+	"slices"
+	"strings"
+)
+
+// minifyCSS removes comments and any whitespace which doesn't change the meaning of a stylesheet.
+// Strings are copied through untouched.
+func minifyCSS(src []byte) []byte {
+	out := bytes.NewBuffer(make([]byte, 0, len(src)))
+	space := false
+
+	// writeSpace writes a pending space, unless it is next to punctuation which doesn't need one.
+	// Spaces before a colon are kept as they matter in selectors (div :hover), as are spaces around
+	// plus signs as they matter in calc().
+	writeSpace := func(next byte) {
+		if space && out.Len() > 0 && !strings.ContainsRune("{};:,>~(", rune(out.Bytes()[out.Len()-1])) &&
+			!strings.ContainsRune("{};,>~)!", rune(next)) {
+			out.WriteByte(' ')
+		}
+		space = false
+	}
+
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+
+		switch {
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if end < 0 {
+				i = len(src)
+			} else {
+				i += end + 3
+			}
+			space = true
+		case c == '"' || c == '\'':
+			writeSpace(c)
+			end := skipString(src, i)
+			out.Write(src[i:end])
+			i = end - 1
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			space = true
+		case c == '}':
+			// the last declaration in a block doesn't need its semicolon
+			if out.Len() > 0 && out.Bytes()[out.Len()-1] == ';' {
+				out.Truncate(out.Len() - 1)
+			}
+			space = false
+			out.WriteByte(c)
+		default:
+			writeSpace(c)
+			out.WriteByte(c)
+		}
+	}
+
+	return out.Bytes()
+}
+
+// minifyJS conservatively shrinks a script by removing comments, along with indentation, trailing
+// whitespace and blank lines. Line breaks are kept so that automatic semicolon insertion still
+// applies, and strings, template literals and regular expressions are copied as they are.
+func minifyJS(src []byte) []byte {
+	out := bytes.NewBuffer(make([]byte, 0, len(src)))
+	line := make([]byte, 0)
+
+	// the last token written, which tells a regular expression from a division
+	var prev byte
+	prevWord := ""
+
+	// the open braces within each ${} of the template literals being read, innermost last
+	templates := make([]int, 0)
+
+	endLine := func() {
+		line = bytes.TrimRight(line, " \t\r")
+		if len(line) > 0 {
+			out.Write(line)
+			out.WriteByte('\n')
+		}
+		line = line[:0]
+	}
+
+	for i := 0; i < len(src); {
+		c := src[i]
+
+		switch {
+		case c == '\n':
+			endLine()
+			i++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f':
+			// indentation is dropped, and trailing whitespace when the line ends
+			if len(line) > 0 {
+				line = append(line, c)
+			}
+			i++
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if end < 0 {
+				end = len(src)
+			} else {
+				end += i + 4
+			}
+
+			// a comment spanning lines ends a statement just as a line break does
+			if bytes.IndexByte(src[i:end], '\n') >= 0 {
+				endLine()
+			} else if len(line) > 0 {
+				line = append(line, ' ')
+			}
+			i = end
+		case c == '/' && regexAllowed(prev, prevWord):
+			end := skipRegex(src, i)
+			line = append(line, src[i:end]...)
+			prev, prevWord = '/', ""
+			i = end
+		case c == '"' || c == '\'':
+			end := skipString(src, i)
+			line = append(line, src[i:end]...)
+			prev, prevWord = c, ""
+			i = end
+		case c == '`' || (c == '}' && len(templates) > 0 && templates[len(templates)-1] == 0):
+			if c == '}' {
+				templates = templates[:len(templates)-1]
+			}
+
+			end, expr := skipTemplate(src, i)
+			line = append(line, src[i:end]...)
+			if expr {
+				templates = append(templates, 0)
+				prev, prevWord = '{', ""
+			} else {
+				prev, prevWord = '`', ""
+			}
+			i = end
+		case isJSWord(c):
+			start := i
+			for i < len(src) && isJSWord(src[i]) {
+				i++
+			}
+			line = append(line, src[start:i]...)
+			prev, prevWord = c, string(src[start:i])
+		default:
+			if len(templates) > 0 && c == '{' {
+				templates[len(templates)-1]++
+			} else if len(templates) > 0 && c == '}' {
+				templates[len(templates)-1]--
+			}
+
+			line = append(line, c)
+			prev, prevWord = c, ""
+			i++
+		}
+	}
+	endLine()
+
+	return out.Bytes()
+}
+
+// regexKeywords are the keywords after which a slash starts a regular expression.
+var regexKeywords = []string{"return", "typeof", "instanceof", "in", "of", "new", "delete", "void", "throw", "case", "do", "else", "yield", "await"}
+
+// regexAllowed reports whether a slash after the token ending in prev, which is the word prevWord if
+// any, starts a regular expression rather than being a division.
+func regexAllowed(prev byte, prevWord string) bool {
+	if prevWord != "" {
+		return slices.Contains(regexKeywords, prevWord)
+	}
+
+	return prev == 0 || strings.IndexByte("(,=:[!&|?{};+-*%<>~^", prev) >= 0
+}
+
+// isJSWord reports whether c can be part of an identifier, keyword or number.
+func isJSWord(c byte) bool {
+	return isASCIILetter(c) || (c >= '0' && c <= '9') || c == '_' || c == '$' || c >= 0x80
+}
+
+// skipRegex returns the index just past the regular expression literal starting at src[start],
+// not including its flags.
+func skipRegex(src []byte, start int) int {
+	class := false
+	for i := start + 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '[':
+			class = true
+		case ']':
+			class = false
+		case '/':
+			if !class {
+				return i + 1
+			}
+		case '\n':
+			return i
+		}
+	}
+
+	return len(src)
+}
+
+// skipTemplate returns the index just past the part of a template literal starting at src[start],
+// which is either its opening backtick or the brace closing a ${} within it. expr reports whether the
+// part ends by opening a ${}, rather than with the closing backtick.
+func skipTemplate(src []byte, start int) (end int, expr bool) {
+	for i := start + 1; i < len(src); i++ {
+		switch {
+		case src[i] == '\\':
+			i++
+		case src[i] == '`':
+			return i + 1, false
+		case src[i] == '$' && i+1 < len(src) && src[i+1] == '{':
+			return i + 2, true
+		}
+	}
+
+	return len(src), false
+}
+
+// skipString returns the index just past the quoted string starting at src[start].
+func skipString(src []byte, start int) int {
+	quote := src[start]
+	for i := start + 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case quote, '\n':
+			return i + 1
+		}
+	}
+
+	return len(src)
+}
+
+// MinifyOpts configures the minification of the files written by a build.
+type MinifyOpts struct {
+	HTML   bool `json:"html"`   // whether to minify rendered html pages
+	Static bool `json:"static"` // whether to also minify html, svg and xml files in static/
+}
+
+// minifyStats is the number of files minified by a build and their size before and after.
+type minifyStats struct {
+	Files  int
+	Before int
+	After  int
+}
+
+// isMinifiedStatic reports whether a static file is minified when MinifyOpts.Static is set.
+func isMinifiedStatic(relPath string) bool {
+	switch strings.ToLower(path.Ext(relPath)) {
+	case ".html", ".svg", ".xml":
+		return true
+	}
+
+	return false
+}
+
+// minify minifies content, recording the saving against the build.
+func (pb *PageBuilder) minify(content []byte) []byte {
+	minified := minifyHTML(content)
+
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	pb.minified.Files++
+	pb.minified.Before += len(content)
+	pb.minified.After += len(minified)
+
+	return minified
+}
+
+// logMinified reports how much minification saved over the build.
+func (pb *PageBuilder) logMinified() {
+	if pb.minified.Files == 0 {
+		return
+	}
+
+	saved := pb.minified.Before - pb.minified.After
+	log.Info("minified files",
+		"files", pb.minified.Files,
+		"saved", fmt.Sprintf("%d bytes (%.1f%%)", saved, 100*float64(saved)/float64(max(pb.minified.Before, 1))),
+	)
+}
+
+// rawElements are the elements whose content is copied through minifyHTML untouched.
+var rawElements = []string{"pre", "textarea", "script", "style"}
+
+// minifyHTML removes comments and collapses runs of whitespace to a single space. The content of
+// <pre>, <textarea>, <script> and <style> elements, quoted attribute values and conditional comments
+// are left as they are. Whitespace is never removed entirely, as between inline elements it is
+// rendered.
+func minifyHTML(src []byte) []byte {
+	out := bytes.NewBuffer(make([]byte, 0, len(src)))
+
+	for i := 0; i < len(src); {
+		c := src[i]
+
+		switch {
+		case bytes.HasPrefix(src[i:], []byte("<!--")):
+			end := bytes.Index(src[i+4:], []byte("-->"))
+			if end < 0 {
+				end = len(src)
+			} else {
+				end += i + 7
+			}
+
+			// conditional comments are read by old versions of internet explorer, so must be kept
+			if bytes.HasPrefix(src[i+4:], []byte("[if")) || bytes.HasPrefix(src[i+4:], []byte("<![endif]")) {
+				out.Write(src[i:end])
+			}
+			i = end
+		case bytes.HasPrefix(src[i:], []byte("<![CDATA[")):
+			end := bytes.Index(src[i:], []byte("]]>"))
+			if end < 0 {
+				end = len(src)
+			} else {
+				end += i + 3
+			}
+			out.Write(src[i:end])
+			i = end
+		case c == '<' && i+1 < len(src) && (isASCIILetter(src[i+1]) || src[i+1] == '/' || src[i+1] == '!'):
+			end := copyTag(out, src, i)
+			if name := rawElement(src[i:end]); name != "" {
+				closing := indexFold(src[end:], "</"+name)
+				if closing < 0 {
+					closing = len(src) - end
+				}
+				out.Write(src[end : end+closing])
+				end += closing
+			}
+			i = end
+		case isHTMLSpace(c):
+			for i < len(src) && isHTMLSpace(src[i]) {
+				i++
+			}
+			// a removed comment can leave whitespace on both sides of it
+			if out.Len() > 0 && out.Bytes()[out.Len()-1] != ' ' && i < len(src) {
+				out.WriteByte(' ')
+			}
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+
+	return out.Bytes()
+}
+
+// copyTag writes the tag starting at src[start] to out, collapsing whitespace outside of quoted
+// attribute values, and returns the index just past the end of the tag.
+func copyTag(out *bytes.Buffer, src []byte, start int) int {
+	var quote byte
+	space := false
+
+	for i := start; i < len(src); i++ {
+		c := src[i]
+
+		switch {
+		case quote != 0:
+			out.WriteByte(c)
+			if c == quote {
+				quote = 0
+			}
+		case isHTMLSpace(c):
+			space = true
+		case c == '>':
+			out.WriteByte(c)
+			return i + 1
+		default:
+			if space && c != '/' {
+				out.WriteByte(' ')
+			} else if space && c == '/' && i+1 < len(src) && src[i+1] != '>' {
+				out.WriteByte(' ')
+			}
+			space = false
+
+			if c == '"' || c == '\'' {
+				quote = c
+			}
+			out.WriteByte(c)
+		}
+	}
+
+	return len(src)
+}
+
+// rawElement returns the name of the element opened by tag if its content should be left untouched.
+func rawElement(tag []byte) string {
+	name := bytes.TrimPrefix(tag, []byte("<"))
+	end := bytes.IndexFunc(name, func(r rune) bool {
+		return !(r < 128 && (isASCIILetter(byte(r)) || (r >= '0' && r <= '9')))
+	})
+	if end >= 0 {
+		name = name[:end]
+	}
+
+	for _, raw := range rawElements {
+		if strings.EqualFold(string(name), raw) {
+			return raw
+		}
+	}
+
+	return ""
+}
+
+// indexFold is bytes.Index, ignoring ASCII case.
+func indexFold(s []byte, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if strings.EqualFold(string(s[i:i+len(substr)]), substr) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
@@ -0,0 +1,154 @@
+package shizuka
+
+import "testing"
+
+func TestMinifyJS(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "comments and indentation",
+			src:  "// header\nfunction f() {\n    /* block */\n    return 1; // trailing\n\n}\n",
+			want: "function f() {\nreturn 1;\n}\n",
+		},
+		{
+			name: "comment spanning lines",
+			src:  "a = 1 /* one\ntwo */ b = 2\n",
+			want: "a = 1\nb = 2\n",
+		},
+		{
+			name: "urls in strings",
+			src:  "const a = \"https://example.com/x\";\nconst b = 'http://example.com/*y*/';\n",
+			want: "const a = \"https://example.com/x\";\nconst b = 'http://example.com/*y*/';\n",
+		},
+		{
+			name: "template literal across lines",
+			src:  "const html = `\n  <p>\n    // not a comment\n    /* nor this */\n  </p>\n`;\n",
+			want: "const html = `\n  <p>\n    // not a comment\n    /* nor this */\n  </p>\n`;\n",
+		},
+		{
+			name: "template literal with expressions",
+			src:  "const s = `${a ? `${b}//x` : {c: 1}.c}\n  // kept\n`; // dropped\n",
+			want: "const s = `${a ? `${b}//x` : {c: 1}.c}\n  // kept\n`;\n",
+		},
+		{
+			name: "regular expressions",
+			src:  "const re = /\\/\\/[/*]+/g;\nif (/^\\/\\*/.test(s)) return s.split(/\\//);\n",
+			want: "const re = /\\/\\/[/*]+/g;\nif (/^\\/\\*/.test(s)) return s.split(/\\//);\n",
+		},
+		{
+			name: "division",
+			src:  "x = a / b / c; // half\ny = (a) / 2 // third\n",
+			want: "x = a / b / c;\ny = (a) / 2\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := string(minifyJS([]byte(test.src))); got != test.want {
+				t.Errorf("minifyJS(%q)\n= %q\nwant %q", test.src, got, test.want)
+			}
+		})
+	}
+}
+
+func TestMinifyHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "whitespace between tags",
+			src:  "<ul>\n    <li>One</li>\n\n    <li>Two</li>\n</ul>\n",
+			want: "<ul> <li>One</li> <li>Two</li> </ul>",
+		},
+		{
+			name: "whitespace in text",
+			src:  "<p>Some   text\n\tacross lines</p>",
+			want: "<p>Some text across lines</p>",
+		},
+		{
+			name: "comments",
+			src:  "<p>a</p>\n<!-- a comment -->\n<p>b</p>",
+			want: "<p>a</p> <p>b</p>",
+		},
+		{
+			name: "conditional comments",
+			src:  "<!--[if IE]>\n  <p>old</p>\n<![endif]-->\n<p>new</p>",
+			want: "<!--[if IE]>\n  <p>old</p>\n<![endif]--> <p>new</p>",
+		},
+		{
+			name: "pre",
+			src:  "<div>\n  <pre>  indented\n    code  </pre>\n</div>",
+			want: "<div> <pre>  indented\n    code  </pre> </div>",
+		},
+		{
+			name: "textarea",
+			src:  "<TEXTAREA name=\"x\">\n  line one\n\n  line two\n</TEXTAREA>",
+			want: "<TEXTAREA name=\"x\">\n  line one\n\n  line two\n</TEXTAREA>",
+		},
+		{
+			name: "script and style",
+			src:  "<script>\n  if (a  <  b) { x = \"<!-- -->\"; }\n</script>\n<style>\n  p  { color: red; }\n</style>",
+			want: "<script>\n  if (a  <  b) { x = \"<!-- -->\"; }\n</script> <style>\n  p  { color: red; }\n</style>",
+		},
+		{
+			name: "attributes",
+			src:  "<a   href=\"/x\"\n   title=\"two  spaces\"  >link</a>",
+			want: "<a href=\"/x\" title=\"two  spaces\">link</a>",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := string(minifyHTML([]byte(test.src))); got != test.want {
+				t.Errorf("minifyHTML(%q)\n= %q\nwant %q", test.src, got, test.want)
+			}
+		})
+	}
+}
+
+func TestMinifyCSS(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "whitespace and final semicolons",
+			src:  "body {\n    color: red;\n    margin: 0 auto;\n}\n\np { padding: 1em; }\n",
+			want: "body{color:red;margin:0 auto}p{padding:1em}",
+		},
+		{
+			name: "comments",
+			src:  "/* header */\na { color: blue; /* inline */ }\n",
+			want: "a{color:blue}",
+		},
+		{
+			name: "strings",
+			src:  "a::after { content: \"  /* not a comment */  \"; font-family: 'Some  Font'; }",
+			want: "a::after{content:\"  /* not a comment */  \";font-family:'Some  Font'}",
+		},
+		{
+			name: "selectors",
+			src:  "div :hover, ul > li ~ p + a { color: red }",
+			want: "div :hover,ul>li~p + a{color:red}",
+		},
+		{
+			name: "calc",
+			src:  "a { width: calc(100% - 2em + 1px) !important; }",
+			want: "a{width:calc(100% - 2em + 1px)!important}",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := string(minifyCSS([]byte(test.src))); got != test.want {
+				t.Errorf("minifyCSS(%q)\n= %q\nwant %q", test.src, got, test.want)
+			}
+		})
+	}
+}
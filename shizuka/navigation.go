@@ -0,0 +1,82 @@
+package shizuka
+
+import (
+	"path"
+	"strings"
+)
+
+// parentPath returns the path of the section containing relPath, or "" for the root.
+func parentPath(relPath string) string {
+	if relPath == "/" {
+		return ""
+	}
+
+	return path.Dir(relPath)
+}
+
+// parentOf returns the path of the section containing relPath. Unlike parentPath, the root page of
+// each language is treated as a root, so it returns "" for "/ja" rather than "/".
+func (pb *PageBuilder) parentOf(relPath string) string {
+	lang := pb.Opts.Languages.Match(relPath)
+	if prefix := pb.Opts.Languages.Prefix(lang); prefix != "" && relPath == prefix {
+		return ""
+	}
+
+	return parentPath(relPath)
+}
+
+// permalink joins the base URL of the site with a page path.
+func permalink(baseURL, relPath string) string {
+	return strings.TrimSuffix(baseURL, "/") + relPath
+}
+
+// lite looks up the page at relPath, returning nil if there isn't one.
+func (pb *PageBuilder) lite(relPath string) *Lite {
+	page, ok := pb.pages[relPath]
+	if !ok {
+		return nil
+	}
+
+	lite := page.Lite()
+	return &lite
+}
+
+// ancestors returns the pages above relPath, ordered from the root down to the direct parent.
+// Directories without an index page are skipped.
+func (pb *PageBuilder) ancestors(relPath string) []Lite {
+	ancestors := make([]Lite, 0)
+
+	for p := pb.parentOf(relPath); p != ""; p = pb.parentOf(p) {
+		if lite := pb.lite(p); lite != nil {
+			ancestors = append([]Lite{*lite}, ancestors...)
+		}
+	}
+
+	return ancestors
+}
+
+// siblings returns the pages either side of relPath in the sort order of its section.
+// prev is the entry listed before the page (newer), next is the entry listed after it (older).
+func (pb *PageBuilder) siblings(relPath string) (prev, next *Lite) {
+	parent := pb.parentOf(relPath)
+	if parent == "" {
+		return nil, nil
+	}
+
+	section := pb.pageMap[parent]
+	for i, lite := range section {
+		if lite.Path != relPath {
+			continue
+		}
+
+		if i > 0 {
+			prev = &section[i-1]
+		}
+		if i < len(section)-1 {
+			next = &section[i+1]
+		}
+		break
+	}
+
+	return prev, next
+}
@@ -0,0 +1,186 @@
+package shizuka
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Output is where a site is written. Every build calls Begin, then WriteFile for each file of the
+// site, then either Commit if the build succeeded or Abort if it didn't, including when Begin itself
+// failed. WriteFile may be called from many goroutines at once.
+type Output interface {
+	// Begin starts writing. If replace is true the files written make up the whole site and replace
+	// everything already in the output, otherwise they are written over the existing output.
+	Begin(replace bool) error
+
+	// WriteFile writes content to name, a slash-separated path relative to the root of the output.
+	WriteFile(name string, content []byte) error
+
+	// Commit finishes writing, making the files written visible.
+	Commit() error
+
+	// Abort discards whatever has been written since Begin, where possible.
+	Abort() error
+}
+
+// dirMaker is implemented by outputs which can hold empty directories.
+type dirMaker interface {
+	MkdirAll(name string) error
+}
+
+// warner is implemented by outputs which can find problems that don't stop a build, such as a stale
+// lock being taken over. They are given the page builder's warn, so the problems reach the manifest.
+type warner interface {
+	setWarn(warn func(msg string, keyvals ...any))
+}
+
+// outputName turns a rooted destination path, such as "/posts/1/index.html", into a path relative to
+// the root of the output.
+func outputName(dstPath string) string {
+	return strings.TrimPrefix(path.Clean("/"+dstPath), "/")
+}
+
+// writeFile writes content to the output at dstPath.
+func (pb *PageBuilder) writeFile(dstPath string, content []byte) error {
+	return pb.writeOutput(ManifestFile{Path: dstPath}, content)
+}
+
+// copyFile copies the source file at srcPath to the output at dstPath.
+func (pb *PageBuilder) copyFile(srcPath, dstPath string) error {
+	content, err := fs.ReadFile(pb.fsys, srcPath)
+	if err != nil {
+		return fmt.Errorf("failed to read source file %s: %w", srcPath, err)
+	}
+
+	return pb.writeOutput(ManifestFile{Path: dstPath, Source: srcPath}, content)
+}
+
+// MapOutput keeps a site in memory, keyed by slash-separated path.
+type MapOutput struct {
+	Files map[string][]byte // the files of the last committed build
+
+	mu      sync.Mutex
+	pending map[string][]byte
+}
+
+func NewMapOutput() *MapOutput {
+	return &MapOutput{
+		Files: make(map[string][]byte),
+	}
+}
+
+func (m *MapOutput) Begin(replace bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if replace {
+		m.pending = make(map[string][]byte)
+	} else {
+		m.pending = maps.Clone(m.Files)
+	}
+
+	return nil
+}
+
+func (m *MapOutput) WriteFile(name string, content []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.pending == nil {
+		return errors.New("write to output before Begin")
+	}
+
+	m.pending[name] = bytes.Clone(content)
+	return nil
+}
+
+func (m *MapOutput) Commit() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Files = m.pending
+	m.pending = nil
+	return nil
+}
+
+func (m *MapOutput) Abort() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pending = nil
+	return nil
+}
+
+// ZipOutput writes a site as a zip archive. Files are held in memory until the build is committed,
+// then written in order of their path, so the same site always makes the same archive.
+type ZipOutput struct {
+	w io.Writer
+
+	mu      sync.Mutex
+	pending map[string][]byte
+}
+
+func NewZipOutput(w io.Writer) *ZipOutput {
+	return &ZipOutput{w: w}
+}
+
+func (z *ZipOutput) Begin(replace bool) error {
+	if !replace {
+		return errors.New("a zip archive can only be written in full")
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	z.pending = make(map[string][]byte)
+	return nil
+}
+
+func (z *ZipOutput) WriteFile(name string, content []byte) error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	if z.pending == nil {
+		return errors.New("write to output before Begin")
+	}
+
+	z.pending[name] = bytes.Clone(content)
+	return nil
+}
+
+func (z *ZipOutput) Commit() error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	archive := zip.NewWriter(z.w)
+	for _, name := range slices.Sorted(maps.Keys(z.pending)) {
+		file, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		if err != nil {
+			return fmt.Errorf("failed to add %s to archive: %w", name, err)
+		}
+
+		if _, err := file.Write(z.pending[name]); err != nil {
+			return fmt.Errorf("failed to add %s to archive: %w", name, err)
+		}
+	}
+
+	z.pending = nil
+	return archive.Close()
+}
+
+func (z *ZipOutput) Abort() error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	z.pending = nil
+	return nil
+}
@@ -0,0 +1,123 @@
+package shizuka
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"maps"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+// testOutputSite is a small site with a page, a static file and a resource beside the page.
+func testOutputSite() fstest.MapFS {
+	return fstest.MapFS{
+		"templates/page.tmpl":     {Data: []byte(`<h1>{{ .Title }}</h1>{{ .Content }}`)},
+		"content/index.md":        {Data: []byte("---\ntitle: \"Home\"\ntemplate: \"page.tmpl\"\n---\n\nHello\n")},
+		"content/posts/index.md":  {Data: []byte("---\ntitle: \"Posts\"\ntemplate: \"page.tmpl\"\n---\n")},
+		"content/posts/photo.jpg": {Data: []byte("jpg")},
+		"static/styles.css":       {Data: []byte("body { color: red; }")},
+	}
+}
+
+func TestBuildMapOutput(t *testing.T) {
+	fsys := testOutputSite()
+
+	out := NewMapOutput()
+	pb := NewPageBuilder(fsys, out)
+	pb.Opts.Manifest = true
+
+	if err := pb.Index(); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	if err := pb.Build(); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	want := map[string]string{
+		"index.html":       "<h1>Home</h1><p>Hello</p>\n",
+		"posts/index.html": "<h1>Posts</h1>",
+		"posts/photo.jpg":  "jpg",
+		"styles.css":       "body { color: red; }",
+	}
+	for name, content := range want {
+		if got, ok := out.Files[name]; !ok {
+			t.Errorf("%s: not written", name)
+		} else if string(got) != content {
+			t.Errorf("%s: %q, want %q", name, got, content)
+		}
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(out.Files["build-manifest.json"], &manifest); err != nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+
+	listed := make([]string, 0)
+	for _, file := range manifest.Files {
+		listed = append(listed, file.Path)
+	}
+
+	// the sitemap is always written, if empty
+	names := append(slices.Sorted(maps.Keys(want)), "sitemap.xml")
+	slices.Sort(names)
+	if !slices.Equal(listed, names) {
+		t.Errorf("manifest lists %v, want %v", listed, names)
+	}
+
+	// a failed build leaves the last build as it was
+	fsys["templates/page.tmpl"] = &fstest.MapFile{Data: []byte(`{{ .Missing.Field }}`)}
+	if err := pb.Index(); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	if err := pb.Build(); err == nil {
+		t.Fatalf("Build succeeded with a broken template")
+	}
+	if got := string(out.Files["index.html"]); got != want["index.html"] {
+		t.Errorf("index.html after a failed build: %q, want %q", got, want["index.html"])
+	}
+}
+
+func TestBuildZipOutput(t *testing.T) {
+	var buf bytes.Buffer
+
+	pb := NewPageBuilder(testOutputSite(), NewZipOutput(&buf))
+	if err := pb.Index(); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	if err := pb.Build(); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("failed to read archive: %v", err)
+	}
+
+	names := make([]string, 0)
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+	}
+
+	want := []string{"index.html", "posts/index.html", "posts/photo.jpg", "sitemap.xml", "styles.css"}
+	if !slices.Equal(names, want) {
+		t.Fatalf("archive holds %v, want %v", names, want)
+	}
+
+	file, err := archive.Open("styles.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if content, _ := io.ReadAll(file); string(content) != "body { color: red; }" {
+		t.Errorf("styles.css: %q", content)
+	}
+
+	// an archive can't be written over
+	if err := pb.Rebuild([]string{"content/index.md"}); err == nil {
+		t.Errorf("Rebuild into an archive succeeded")
+	}
+}
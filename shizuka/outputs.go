@@ -0,0 +1,159 @@
+package shizuka
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// OutputFormat describes one of the files a page can be rendered to.
+type OutputFormat struct {
+	Name      string `json:"name"`
+	MediaType string `json:"media_type"`
+	Suffix    string `json:"suffix"`   // inserted before .tmpl in the template name, e.g. "json" for post.json.tmpl
+	Filename  string `json:"filename"` // the name of the rendered file within the page's output directory
+}
+
+// HTMLFormat is the format every page is rendered to unless told otherwise.
+var HTMLFormat = OutputFormat{
+	Name:      "html",
+	MediaType: "text/html",
+	Filename:  "index.html",
+}
+
+// DefaultOutputFormats are the formats available without any configuration.
+var DefaultOutputFormats = map[string]OutputFormat{
+	"html": HTMLFormat,
+	"json": {
+		Name:      "json",
+		MediaType: "application/json",
+		Suffix:    "json",
+		Filename:  "index.json",
+	},
+	"txt": {
+		Name:      "txt",
+		MediaType: "text/plain",
+		Suffix:    "txt",
+		Filename:  "index.txt",
+	},
+}
+
+// OutputLink points at one of the outputs of a page.
+type OutputLink struct {
+	Name      string
+	MediaType string
+	Path      string
+	Permalink string
+}
+
+// executor is satisfied by both html/template and text/template templates.
+type executor interface {
+	Execute(w io.Writer, data any) error
+}
+
+// isHTMLTemplate reports whether a template file produces HTML, and so should be parsed with html/template.
+// post.tmpl and post.html.tmpl are HTML, whereas post.json.tmpl and post.txt.tmpl are not.
+func isHTMLTemplate(file string) bool {
+	ext := path.Ext(strings.TrimSuffix(path.Base(file), ".tmpl"))
+	return ext == "" || ext == ".html"
+}
+
+// formatTemplate returns the name of the template used to render a page in the given format.
+func formatTemplate(name string, format OutputFormat) string {
+	if format.Suffix == "" {
+		return name
+	}
+
+	return strings.TrimSuffix(name, ".tmpl") + "." + format.Suffix + ".tmpl"
+}
+
+// formatDstPath returns where a page rendered to htmlDstPath should be written in the given format.
+func formatDstPath(htmlDstPath string, format OutputFormat) string {
+	if format.Filename == HTMLFormat.Filename {
+		return htmlDstPath
+	}
+
+	return path.Join(path.Dir(htmlDstPath), format.Filename)
+}
+
+// formatPath returns the URL path of a page at relPath in the given format.
+func formatPath(relPath string, format OutputFormat) string {
+	if format.Filename == HTMLFormat.Filename {
+		return relPath
+	}
+
+	return path.Join(relPath, format.Filename)
+}
+
+// lookupTemplate finds a template by name in either the HTML or the plain text template set for a language.
+func (pb *PageBuilder) lookupTemplate(lang, name string) executor {
+	templates, ok := pb.langTemplates[lang]
+	if !ok {
+		templates = pb.templates
+	}
+
+	textTemplates, ok := pb.langTextTemplates[lang]
+	if !ok {
+		textTemplates = pb.textTemplates
+	}
+
+	if temp := templates.Lookup(name); temp != nil {
+		return temp
+	}
+
+	if temp := textTemplates.Lookup(name); temp != nil {
+		return temp
+	}
+
+	return nil
+}
+
+// outputFormats returns the formats the page at relPath is rendered to. Formats listed in the
+// frontmatter take precedence, followed by those configured for the closest enclosing section.
+func (pb *PageBuilder) outputFormats(relPath string, names []string) ([]OutputFormat, error) {
+	if len(names) == 0 {
+		for p := relPath; p != "" && len(names) == 0; p = parentPath(p) {
+			names = pb.Opts.Outputs[p]
+		}
+	}
+
+	if len(names) == 0 {
+		return []OutputFormat{HTMLFormat}, nil
+	}
+
+	formats := make([]OutputFormat, 0, len(names))
+	for _, name := range names {
+		format, ok := pb.Opts.OutputFormats[name]
+		if !ok {
+			format, ok = DefaultOutputFormats[name]
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown output format %q", name)
+		}
+
+		if format.Name == "" {
+			format.Name = name
+		}
+
+		formats = append(formats, format)
+	}
+
+	return formats, nil
+}
+
+// outputLinks returns links to every output of a page.
+func (pb *PageBuilder) outputLinks(relPath string, formats []OutputFormat) []OutputLink {
+	links := make([]OutputLink, len(formats))
+	for i, format := range formats {
+		p := formatPath(relPath, format)
+		links[i] = OutputLink{
+			Name:      format.Name,
+			MediaType: format.MediaType,
+			Path:      p,
+			Permalink: permalink(pb.Opts.BaseURL, p),
+		}
+	}
+
+	return links
+}
@@ -0,0 +1,147 @@
+package shizuka
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"path"
+	"strconv"
+)
+
+// aliasTemplate redirects a duplicate URL to its canonical page.
+var aliasTemplate = template.Must(template.New("alias").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <title>{{ . }}</title>
+    <link rel="canonical" href="{{ . }}">
+    <meta http-equiv="refresh" content="0; url={{ . }}">
+</head>
+</html>
+`))
+
+// Paginator is a single page of a paginated list.
+type Paginator struct {
+	Items []Lite // the items on this page
+
+	PageNumber int // the number of this page, starting at 1
+	PageSize   int // the maximum number of items on each page
+	TotalPages int
+	TotalItems int
+
+	URLs  []string // the path of every page, in order
+	First string   // the path of the first page
+	Last  string   // the path of the last page
+	Prev  string   // the path of the previous page, or "" on the first page
+	Next  string   // the path of the next page, or "" on the last page
+}
+
+// pagePath returns the path of page n of a list rooted at base.
+func pagePath(base string, n int) string {
+	if n == 1 {
+		return base
+	}
+
+	return path.Join(base, "page", strconv.Itoa(n))
+}
+
+// paginate splits items into pages of size items, rooted at base.
+// An empty list still produces a single, empty page.
+func paginate(base string, items []Lite, size int) []*Paginator {
+	total := max(1, (len(items)+size-1)/size)
+
+	urls := make([]string, total)
+	for i := range urls {
+		urls[i] = pagePath(base, i+1)
+	}
+
+	paginators := make([]*Paginator, total)
+	for i := range paginators {
+		start := min(i*size, len(items))
+		end := min(start+size, len(items))
+
+		p := &Paginator{
+			Items:      items[start:end],
+			PageNumber: i + 1,
+			PageSize:   size,
+			TotalPages: total,
+			TotalItems: len(items),
+			URLs:       urls,
+			First:      urls[0],
+			Last:       urls[total-1],
+		}
+
+		if i > 0 {
+			p.Prev = urls[i-1]
+		}
+		if i < total-1 {
+			p.Next = urls[i+1]
+		}
+
+		paginators[i] = p
+	}
+
+	return paginators
+}
+
+// indexPagination splits the collections of every paginated page.
+func (pb *PageBuilder) indexPagination() {
+	pb.paginators = make(map[string][]*Paginator)
+
+	for relPath, page := range pb.pages {
+		if page.Paginate <= 0 {
+			continue
+		}
+
+		collection := page.PaginatePath
+		if collection == "" {
+			collection = relPath
+		}
+
+		paginators := paginate(relPath, pb.pageMap[collection], page.Paginate)
+		pb.paginators[relPath] = paginators
+
+		if pb.Opts.UseSitemap && page.SitemapInclude {
+			for _, p := range paginators[1:] {
+				pb.sitemap.AddURL(p.URLs[p.PageNumber-1], page.Date, "", "")
+			}
+		}
+	}
+}
+
+// buildPagination renders every page of a paginated page in each of its formats, along with an alias
+// from page/1 to the first page.
+func (pb *PageBuilder) buildPagination(page Page) error {
+	for _, paginator := range pb.paginators[page.Location.RelPath] {
+		for _, format := range page.Outputs {
+			data := pb.pageData(page)
+			data.Path = paginator.URLs[paginator.PageNumber-1]
+			data.Permalink = permalink(pb.Opts.BaseURL, data.Path)
+			data.Paginator = paginator
+			data.OutputFormat = format.Name
+			data.Outputs = pb.outputLinks(data.Path, page.Outputs)
+
+			dstPath := formatDstPath(page.Location.DstPath, format)
+			if paginator.PageNumber > 1 {
+				dstPath = path.Join(data.Path, format.Filename)
+			}
+
+			name := formatTemplate(page.Template, format)
+			if err := pb.renderPage(name, page.Location.SrcPath, dstPath, data); err != nil {
+				return err
+			}
+		}
+	}
+
+	return pb.buildAlias(path.Join(page.Location.RelPath, "page", "1"), page.Location.RelPath)
+}
+
+// buildAlias writes a page at from which redirects to the page at to.
+func (pb *PageBuilder) buildAlias(from, to string) error {
+	buf := bytes.NewBuffer(nil)
+	if err := aliasTemplate.Execute(buf, to); err != nil {
+		return fmt.Errorf("failed to render alias %s: %w", from, err)
+	}
+
+	return pb.writeFile(path.Join(from, "index.html"), buf.Bytes())
+}
@@ -0,0 +1,48 @@
+package shizuka
+
+import (
+	"runtime"
+	"sync"
+)
+
+// jobs returns the number of workers to spread indexing and rendering across.
+func (pb *PageBuilder) jobs() int {
+	if pb.Opts.Jobs > 0 {
+		return pb.Opts.Jobs
+	}
+
+	return runtime.GOMAXPROCS(0)
+}
+
+// parallel calls fn with every index from 0 to n-1, spread across a pool of pb.jobs() workers. Every
+// call is made even if some fail, and the error of the lowest failing index is returned, so the
+// result doesn't depend on the order the calls happened to finish in.
+func (pb *PageBuilder) parallel(n int, fn func(i int) error) error {
+	errs := make([]error, n)
+	next := make(chan int)
+
+	var wg sync.WaitGroup
+	for range min(pb.jobs(), n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				errs[i] = fn(i)
+			}
+		}()
+	}
+
+	for i := range n {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package shizuka
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// RelatedOpts configures how related pages are found.
+type RelatedOpts struct {
+	Count    int      `json:"count"`    // the number of related pages to find for each page, or 0 to disable
+	Sections []string `json:"sections"` // only relate pages within these sections, in every language, or every page if empty
+
+	TagWeight     float64 `json:"tag_weight"`     // the score of each shared tag
+	KeywordWeight float64 `json:"keyword_weight"` // the score of each shared meta keyword
+	DataWeight    float64 `json:"data_weight"`    // the score of each data key both pages give the same value
+}
+
+// relatedTerms is what a page is compared on when finding related pages.
+type relatedTerms struct {
+	lite     Lite
+	tags     []string
+	keywords []string
+	data     map[string]any
+}
+
+// inSections reports whether relPath is within any of the given sections, or true if there are none.
+func inSections(relPath string, sections []string) bool {
+	if len(sections) == 0 {
+		return true
+	}
+
+	for _, section := range sections {
+		section = strings.TrimSuffix(section, "/")
+		if strings.HasPrefix(relPath, section+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normaliseTerms normalises every term, dropping any which are empty.
+func normaliseTerms(terms []string) []string {
+	normalised := make([]string, 0, len(terms))
+	for _, term := range terms {
+		if term = normaliseTerm(term); term != "" {
+			normalised = append(normalised, term)
+		}
+	}
+
+	return normalised
+}
+
+// countShared returns the number of terms in a which are also in b.
+func countShared(a, b []string) int {
+	count := 0
+	for _, term := range a {
+		if slices.Contains(b, term) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// relatedScore weighs the overlap between two pages.
+func (opts RelatedOpts) relatedScore(a, b relatedTerms) float64 {
+	score := opts.TagWeight * float64(countShared(a.tags, b.tags))
+	score += opts.KeywordWeight * float64(countShared(a.keywords, b.keywords))
+
+	if opts.DataWeight != 0 {
+		for key, value := range a.data {
+			if other, ok := b.data[key]; ok && fmt.Sprint(value) == fmt.Sprint(other) {
+				score += opts.DataWeight
+			}
+		}
+	}
+
+	return score
+}
+
+// indexRelated finds the most related pages for every page within the configured sections, which are
+// given without a language prefix so that they cover a section in every language. Pages are only
+// related to pages in the same language, and ties are broken by date and then path so that the result
+// doesn't depend on the order pages were indexed in.
+func (pb *PageBuilder) indexRelated() {
+	pb.related = make(map[string][]Lite)
+
+	opts := pb.Opts.Related
+	if opts.Count <= 0 {
+		return
+	}
+
+	if opts.TagWeight == 0 && opts.KeywordWeight == 0 && opts.DataWeight == 0 {
+		opts.TagWeight = 1
+	}
+
+	candidates := make([]relatedTerms, 0)
+	for relPath, page := range pb.pages {
+		if !inSections(page.TranslationKey, opts.Sections) || isNotFound(relPath) {
+			continue
+		}
+
+		candidates = append(candidates, relatedTerms{
+			lite:     page.Lite(),
+			tags:     normaliseTerms(page.Tags),
+			keywords: normaliseTerms(strings.Split(page.MetaKeywords, ",")),
+			data:     page.Data,
+		})
+	}
+
+	type scored struct {
+		lite  Lite
+		score float64
+		date  time.Time
+	}
+
+	for _, page := range candidates {
+		matches := make([]scored, 0)
+		for _, other := range candidates {
+			if other.lite.Path == page.lite.Path || other.lite.Lang != page.lite.Lang {
+				continue
+			}
+
+			if score := opts.relatedScore(page, other); score > 0 {
+				date, _ := time.Parse(dateLayout, other.lite.Date)
+				matches = append(matches, scored{lite: other.lite, score: score, date: date})
+			}
+		}
+
+		slices.SortFunc(matches, func(a, b scored) int {
+			if a.score != b.score {
+				if a.score > b.score {
+					return -1
+				}
+				return +1
+			}
+
+			if c := b.date.Compare(a.date); c != 0 {
+				return c
+			}
+
+			return strings.Compare(a.lite.Path, b.lite.Path)
+		})
+
+		related := make([]Lite, 0, min(opts.Count, len(matches)))
+		for _, match := range matches[:min(opts.Count, len(matches))] {
+			related = append(related, match.lite)
+		}
+
+		pb.related[page.lite.Path] = related
+	}
+}
@@ -0,0 +1,42 @@
+package shizuka
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestIndexRelatedSections(t *testing.T) {
+	fsys := fstest.MapFS{
+		"templates/post.tmpl":   {Data: []byte(`{{ range .Related }}{{ .Path }} {{ end }}`)},
+		"content/posts/a.md":    {Data: []byte(testPost("A", "2024-01-01", "go"))},
+		"content/posts/b.md":    {Data: []byte(testPost("B", "2024-01-02", "go"))},
+		"content/notes/c.md":    {Data: []byte(testPost("C", "2024-01-03", "go"))},
+		"content/posts/a.ja.md": {Data: []byte(testPost("A", "2024-01-01", "go"))},
+		"content/posts/b.ja.md": {Data: []byte(testPost("B", "2024-01-02", "go"))},
+		"content/notes/c.ja.md": {Data: []byte(testPost("C", "2024-01-03", "go"))},
+	}
+
+	out := NewMapOutput()
+	pb := NewPageBuilder(fsys, out)
+	pb.Opts = testOpts()
+	pb.Opts.Related = RelatedOpts{Count: 2, Sections: []string{"/posts"}}
+
+	if err := pb.Index(); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	if err := pb.Build(); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	want := map[string]string{
+		"posts/a/index.html":    "/posts/b ",
+		"notes/c/index.html":    "",
+		"ja/posts/a/index.html": "/ja/posts/b ",
+		"ja/notes/c/index.html": "",
+	}
+	for name, related := range want {
+		if got := string(out.Files[name]); got != related {
+			t.Errorf("%s: related %q, want %q", name, got, related)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package shizuka
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Resource is a file in content/ which belongs to a page, such as an image it links to.
+type Resource struct {
+	Name      string // the name of the file, relative to the page
+	Path      string // the path the file is published at alongside the page
+	MediaType string
+}
+
+// bundleCopy is an extra copy of a resource, written into the output directory of a page.
+type bundleCopy struct {
+	SrcPath string
+	DstPath string
+}
+
+// linkAttr matches the targets of links and images in a page's html.
+var linkAttr = regexp.MustCompile(`(?:src|href)="([^"]*)"`)
+
+// isIndexFile reports whether a content file is the index page of its directory.
+func isIndexFile(srcPath string) bool {
+	return strings.HasPrefix(path.Base(srcPath), "index.") && path.Ext(srcPath) == ".md"
+}
+
+// linkedFiles returns the source paths of the files a page links to relative to its own source file,
+// such as diagram.png in ![](diagram.png).
+func linkedFiles(page Page) map[string]bool {
+	linked := make(map[string]bool)
+	for _, match := range linkAttr.FindAllStringSubmatch(string(page.Content), -1) {
+		target, _, _ := strings.Cut(match[1], "#")
+		target, _, _ = strings.Cut(target, "?")
+		if target == "" || strings.HasPrefix(target, "/") || strings.Contains(target, ":") {
+			continue // absolute, or another site
+		}
+
+		if unescaped, err := url.PathUnescape(target); err == nil {
+			target = unescaped
+		}
+
+		linked[path.Join(path.Dir(page.Location.SrcPath), target)] = true
+	}
+
+	return linked
+}
+
+// indexResources attaches the non-markdown files in content/ to the pages they belong to.
+//
+// A file in a directory with an index.md belongs to that page, and is already published beside it.
+// Files under a directory named after a page, like posts/2/diagram.png beside posts/2.md, belong to
+// that page, and are published beside it too. A file sitting next to other pages, like an image beside
+// posts/2.md, belongs only to those pages which link to it, and is also copied into each of their
+// output directories so that relative links resolve.
+func (pb *PageBuilder) indexResources() {
+	pb.resources = make(map[string][]Resource)
+	pb.bundles = make([]bundleCopy, 0)
+
+	indexes := make(map[string]Page)
+	bundles := make(map[string]Page)
+	leaves := make(map[string][]Page)
+	linked := make(map[string]map[string]bool)
+	for _, page := range pb.pages {
+		if page.Location.SrcPath == "" || path.Ext(page.Location.SrcPath) != ".md" {
+			continue // generated pages have no directory to take resources from
+		}
+
+		dir := path.Dir(page.Location.SrcPath)
+		if isIndexFile(page.Location.SrcPath) {
+			indexes[dir] = page
+			continue
+		}
+
+		bundles[strings.TrimSuffix(page.Location.SrcPath, ".md")] = page
+		leaves[dir] = append(leaves[dir], page)
+		linked[page.Location.SrcPath] = linkedFiles(page)
+	}
+
+	attach := func(page Page, name, relPath, mediaType string) {
+		pb.resources[page.Location.RelPath] = append(pb.resources[page.Location.RelPath], Resource{
+			Name:      name,
+			Path:      relPath,
+			MediaType: mediaType,
+		})
+	}
+
+	for _, file := range pb.content {
+		if path.Ext(file.SrcPath) == ".md" || (strings.HasSuffix(file.SrcPath, "~") && pb.Opts.Dev) {
+			continue
+		}
+
+		dir := path.Dir(file.SrcPath)
+		name := path.Base(file.SrcPath)
+		mediaType := mime.TypeByExtension(path.Ext(name))
+
+		if page, ok := indexes[dir]; ok {
+			attach(page, name, file.RelPath, mediaType)
+		} else {
+			// the nearest directory named after a page, if the file sits under one
+			for bundle := dir; bundle != "." && bundle != "/"; bundle = path.Dir(bundle) {
+				if page, ok := bundles[bundle]; ok {
+					attach(page, strings.TrimPrefix(file.SrcPath, bundle+"/"), file.RelPath, mediaType)
+					break
+				}
+			}
+		}
+
+		for _, page := range leaves[dir] {
+			if !linked[page.Location.SrcPath][file.SrcPath] {
+				continue
+			}
+
+			attach(page, name, path.Join(page.Location.RelPath, name), mediaType)
+			pb.bundles = append(pb.bundles, bundleCopy{
+				SrcPath: file.SrcPath,
+				DstPath: path.Join(path.Dir(page.Location.DstPath), name),
+			})
+		}
+	}
+
+	for _, resources := range pb.resources {
+		slices.SortFunc(resources, func(a, b Resource) int {
+			return strings.Compare(a.Name, b.Name)
+		})
+	}
+
+	slices.SortFunc(pb.bundles, func(a, b bundleCopy) int {
+		return strings.Compare(a.DstPath, b.DstPath)
+	})
+}
+
+// replicateContent copies the non-markdown files in content/ to where they sit in the output, along
+// with the extra copies made for page bundles.
+func (pb *PageBuilder) replicateContent() error {
+	for _, file := range pb.content {
+		if path.Ext(file.SrcPath) == ".md" || (strings.HasSuffix(file.SrcPath, "~") && pb.Opts.Dev) {
+			continue
+		}
+
+		if err := pb.copyFile(file.SrcPath, file.DstPath); err != nil {
+			return err
+		}
+	}
+
+	for _, bundle := range pb.bundles {
+		if err := pb.copyFile(bundle.SrcPath, bundle.DstPath); err != nil {
+			return fmt.Errorf("failed to copy page resource: %w", err)
+		}
+	}
+
+	return nil
+}
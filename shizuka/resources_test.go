@@ -0,0 +1,72 @@
+package shizuka
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestIndexResources(t *testing.T) {
+	page := func(body string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte("---\ntemplate: \"page.tmpl\"\n---\n\n" + body + "\n")}
+	}
+
+	fsys := fstest.MapFS{
+		"templates/page.tmpl": {Data: []byte(`{{ range .Resources }}{{ .Name }}={{ .Path }} {{ end }}`)},
+
+		// leaves which link to a file beside them, or don't
+		"content/posts/a.md":        page("![](diagram.png)"),
+		"content/posts/b.md":        page("no links"),
+		"content/posts/diagram.png": {Data: []byte("png")},
+
+		// a leaf with a directory of its own
+		"content/posts/c.md":            page("![](photo.jpg)"),
+		"content/posts/c/photo.jpg":     {Data: []byte("jpg")},
+		"content/posts/c/raw/photo.nef": {Data: []byte("nef")},
+
+		// a leaf beside an index page
+		"content/notes/index.md": page(""),
+		"content/notes/x.md":     page(`<img src="./y.png?v=1">`),
+		"content/notes/y.png":    {Data: []byte("png")},
+	}
+
+	out := NewMapOutput()
+	pb := NewPageBuilder(fsys, out)
+	pb.Opts = testOpts()
+	pb.Opts.Languages = Languages{}
+
+	if err := pb.Index(); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	if err := pb.Build(); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	pages := map[string]string{
+		"posts/a/index.html": "diagram.png=/posts/a/diagram.png ",
+		"posts/b/index.html": "",
+		"posts/c/index.html": "photo.jpg=/posts/c/photo.jpg raw/photo.nef=/posts/c/raw/photo.nef ",
+		"notes/index.html":   "y.png=/notes/y.png ",
+		"notes/x/index.html": "y.png=/notes/x/y.png ",
+	}
+	for name, want := range pages {
+		if got := string(out.Files[name]); got != want {
+			t.Errorf("%s: resources %q, want %q", name, got, want)
+		}
+	}
+
+	files := map[string]bool{
+		"posts/diagram.png":     true,
+		"posts/a/diagram.png":   true,
+		"posts/b/diagram.png":   false,
+		"posts/c/photo.jpg":     true,
+		"posts/c/raw/photo.nef": true,
+		"posts/c/diagram.png":   false,
+		"notes/y.png":           true,
+		"notes/x/y.png":         true,
+	}
+	for name, want := range files {
+		if _, got := out.Files[name]; got != want {
+			t.Errorf("%s: written %v, want %v", name, got, want)
+		}
+	}
+}
@@ -1,9 +1,10 @@
 package shizuka
 
 import (
+    "bytes"
     "encoding/xml"
     "os"
-    "path/filepath"
+    "strings"
     "time"
 )
 
@@ -12,6 +13,8 @@ type RSS struct {
     Version string     `xml:"version,attr"`
     XMLNS   string     `xml:"xmlns:atom,attr"` // Add Atom namespace
     Channel RssChannel `xml:"channel"`
+
+    buildTime time.Time // used for items whose date can't be parsed
 }
 
 type RssChannel struct {
@@ -38,7 +41,9 @@ type RSSItem struct {
     GUID        string `xml:"guid"`
 }
 
-func NewRSS(baseURL, title, description, language string) *RSS {
+// NewRSS creates an empty feed. buildTime is given as the feed's last build date, so that building
+// the same site at the same time always gives the same feed.
+func NewRSS(baseURL, title, description, language string, buildTime time.Time) *RSS {
     return &RSS{
         Version: "2.0",
         XMLNS:   "http://www.w3.org/2005/Atom",
@@ -52,19 +57,20 @@ func NewRSS(baseURL, title, description, language string) *RSS {
                 Rel:  "self",
                 Type: "application/rss+xml",
             },
-            LastBuildDate: time.Now().Format(time.RFC1123Z),
+            LastBuildDate: buildTime.Format(time.RFC1123Z),
             Items:         make([]RSSItem, 0),
         },
+        buildTime: buildTime,
     }
 }
 
 func (r *RSS) AddItem(link, publishDate, title, description string) {
     date, err := time.Parse("2006-01-02", publishDate)
     if err != nil {
-        date = time.Now() // fallback date if improperly formatted
+        date = r.buildTime // fallback date if improperly formatted
     }
 
-    fullLink := filepath.Join(r.Channel.Link, link)
+    fullLink := strings.TrimSuffix(r.Channel.Link, "/") + link
     r.Channel.Items = append(r.Channel.Items, RSSItem{
         Title:       title,
         Link:        fullLink,
@@ -75,14 +81,24 @@ func (r *RSS) AddItem(link, publishDate, title, description string) {
 }
 
 func (r *RSS) Build(filePath string) error {
-    file, err := os.Create(filePath)
+    content, err := r.Encode()
     if err != nil {
         return err
     }
-    defer file.Close()
 
-    encoder := xml.NewEncoder(file)
+    return os.WriteFile(filePath, content, 0644)
+}
+
+// Encode returns the feed as XML.
+func (r *RSS) Encode() ([]byte, error) {
+    buf := bytes.NewBuffer(nil)
+
+    encoder := xml.NewEncoder(buf)
     encoder.Indent("", "  ")
 
-    return encoder.Encode(r)
+    if err := encoder.Encode(r); err != nil {
+        return nil, err
+    }
+
+    return buf.Bytes(), nil
 }
@@ -0,0 +1,76 @@
+package shizuka
+
+import (
+	"github.com/charmbracelet/log"
+	"path"
+	"slices"
+)
+
+// DefaultSectionTemplate renders sections which have no index page of their own.
+const DefaultSectionTemplate = "section.tmpl"
+
+// indexSections creates a page for every section of the content which contains pages but has no
+// index.md. Nothing is created if the section template doesn't exist. The not found page isn't part of
+// any section, so doesn't make one on its own.
+func (pb *PageBuilder) indexSections() {
+	name := pb.Opts.SectionTemplate
+	if name == "" {
+		name = DefaultSectionTemplate
+	}
+
+	if pb.lookupTemplate(pb.Opts.Languages.Default, name) == nil {
+		log.Debug("no section template, skipping section pages", "template", name)
+		return
+	}
+
+	sections := make([]string, 0)
+	for relPath := range pb.pages {
+		if isNotFound(relPath) {
+			continue
+		}
+
+		for p := pb.parentOf(relPath); p != ""; p = pb.parentOf(p) {
+			if _, ok := pb.pages[p]; ok || slices.Contains(sections, p) {
+				continue
+			}
+
+			sections = append(sections, p)
+		}
+	}
+
+	for _, relPath := range sections {
+		outputs, err := pb.outputFormats(relPath, nil)
+		if err != nil {
+			pb.warn("failed to find output formats, using html", "section", relPath, "error", err)
+			outputs = []OutputFormat{HTMLFormat}
+		}
+
+		lang := pb.Opts.Languages.Match(relPath)
+
+		title := path.Base(relPath)
+		if pb.parentOf(relPath) == "" {
+			title = pb.Opts.SiteTitle
+		}
+
+		pb.pages[relPath] = Page{
+			Title:          title,
+			SitemapInclude: true,
+			Outputs:        outputs,
+			Lang:           lang,
+			TranslationKey: pb.Opts.Languages.TranslationKey(lang, relPath),
+			Location: Location{
+				DstPath: path.Join(relPath, "index.html"),
+				RelPath: relPath,
+				Lang:    lang,
+			},
+			Content:  pb.devContent(),
+			Template: name,
+		}
+
+		pb.pageMap[relPath] = make([]Lite, 0)
+
+		if pb.Opts.UseSitemap {
+			pb.sitemap.AddURL(relPath, "", "", "")
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package shizuka
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestIndexSections(t *testing.T) {
+	fsys := fstest.MapFS{
+		"templates/page.tmpl":    {Data: []byte(`{{ .Title }}`)},
+		"templates/section.tmpl": {Data: []byte(`{{ range .Children }}{{ .Path }} {{ end }}`)},
+		"content/index.md":       {Data: []byte("---\ntemplate: \"page.tmpl\"\n---\n")},
+		"content/posts/a.md":     {Data: []byte("---\ntemplate: \"page.tmpl\"\n---\n")},
+		"content/404.ja.md":      {Data: []byte("---\ntemplate: \"page.tmpl\"\n---\n")},
+	}
+
+	out := NewMapOutput()
+	pb := NewPageBuilder(fsys, out)
+	pb.Opts = testOpts()
+
+	if err := pb.Index(); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	if err := pb.Build(); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	if got, want := string(out.Files["posts/index.html"]), "/posts/a "; got != want {
+		t.Errorf("posts/index.html: %q, want %q", got, want)
+	}
+	if _, ok := out.Files["ja/404.html"]; !ok {
+		t.Errorf("ja/404.html not written")
+	}
+
+	// a language with only a not found page has no section of its own
+	if _, ok := out.Files["ja/index.html"]; ok {
+		t.Errorf("ja/index.html written for a lone not found page")
+	}
+}
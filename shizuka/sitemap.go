@@ -1,23 +1,34 @@
 package shizuka
 
 import (
+	"bytes"
 	"encoding/xml"
 	"os"
-	"path"
+	"slices"
+	"strings"
 )
 
 type SitemapURL struct {
-	Loc        string `xml:"loc"`
-	LastMod    string `xml:"lastmod,omitempty"`
-	ChangeFreq string `xml:"changefreq,omitempty"`
-	Priority   string `xml:"priority,omitempty"`
+	Loc        string        `xml:"loc"`
+	LastMod    string        `xml:"lastmod,omitempty"`
+	ChangeFreq string        `xml:"changefreq,omitempty"`
+	Priority   string        `xml:"priority,omitempty"`
+	Links      []SitemapLink `xml:"xhtml:link,omitempty"`
+}
+
+// SitemapLink points at an alternate language version of a URL.
+type SitemapLink struct {
+	Rel      string `xml:"rel,attr"`
+	HrefLang string `xml:"hreflang,attr"`
+	Href     string `xml:"href,attr"`
 }
 
 type Sitemap struct {
-	XMLName xml.Name     `xml:"urlset"`
-	XMLNS   string       `xml:"xmlns,attr"`
-	URLs    []SitemapURL `xml:"url"`
-	Base    string       `xml:"-"`
+	XMLName    xml.Name     `xml:"urlset"`
+	XMLNS      string       `xml:"xmlns,attr"`
+	XMLNSXHTML string       `xml:"xmlns:xhtml,attr,omitempty"`
+	URLs       []SitemapURL `xml:"url"`
+	Base       string       `xml:"-"`
 }
 
 func NewSitemap(baseURL string) *Sitemap {
@@ -30,22 +41,58 @@ func NewSitemap(baseURL string) *Sitemap {
 
 func (s *Sitemap) AddURL(loc, lastModified, changeFreq, priority string) {
 	s.URLs = append(s.URLs, SitemapURL{
-		Loc:        path.Join(s.Base, loc),
+		Loc:        s.url(loc),
 		LastMod:    lastModified,
 		ChangeFreq: changeFreq,
 		Priority:   priority,
 	})
 }
 
+// AddAlternate links the URL at loc to its translation into lang at href.
+func (s *Sitemap) AddAlternate(loc, lang, href string) {
+	for i := range s.URLs {
+		if s.URLs[i].Loc != s.url(loc) {
+			continue
+		}
+
+		s.XMLNSXHTML = "http://www.w3.org/1999/xhtml"
+		s.URLs[i].Links = append(s.URLs[i].Links, SitemapLink{
+			Rel:      "alternate",
+			HrefLang: lang,
+			Href:     s.url(href),
+		})
+		return
+	}
+}
+
+func (s *Sitemap) url(loc string) string {
+	return strings.TrimSuffix(s.Base, "/") + loc
+}
+
 func (s *Sitemap) Build(filePath string) error {
-	file, err := os.Create(filePath)
+	content, err := s.Encode()
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	encoder := xml.NewEncoder(file)
+	return os.WriteFile(filePath, content, 0644)
+}
+
+// Encode returns the sitemap as XML, with the URLs sorted so that it doesn't depend on the order they
+// were added in.
+func (s *Sitemap) Encode() ([]byte, error) {
+	slices.SortStableFunc(s.URLs, func(a, b SitemapURL) int {
+		return strings.Compare(a.Loc, b.Loc)
+	})
+
+	buf := bytes.NewBuffer(nil)
+
+	encoder := xml.NewEncoder(buf)
 	encoder.Indent("", "  ")
 
-	return encoder.Encode(s)
+	if err := encoder.Encode(s); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
 }
@@ -0,0 +1,220 @@
+package shizuka
+
+import (
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const (
+	taxonomyTemplate = "taxonomy.tmpl"
+	termTemplate     = "term.tmpl"
+)
+
+// Term is a single value of a taxonomy, along with every page that uses it.
+type Term struct {
+	Name  string // the normalised name of the term
+	Slug  string // the URL-safe form of the name
+	Path  string // the path of the term's listing page
+	Count int    // the number of pages using the term
+	Pages []Lite // the pages using the term, newest first
+}
+
+// Taxonomy is a way of grouping pages, such as tags or categories.
+type Taxonomy struct {
+	Name  string  // the frontmatter key the taxonomy is read from
+	Lang  string  // the language of the pages it groups
+	Path  string  // the path of the taxonomy's term list page, under the language's prefix
+	Terms []*Term // every term in the taxonomy, ordered by name
+}
+
+// Term looks up a term by name, returning nil if no page uses it.
+func (t *Taxonomy) Term(name string) *Term {
+	slug := slugify(normaliseTerm(name))
+	for _, term := range t.Terms {
+		if term.Slug == slug {
+			return term
+		}
+	}
+
+	return nil
+}
+
+// normaliseTerm case-folds a term and collapses any whitespace within it.
+func normaliseTerm(term string) string {
+	return strings.Join(strings.Fields(strings.ToLower(term)), " ")
+}
+
+// slugify reduces s to lowercase letters and digits separated by single dashes.
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteRune('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+
+	return b.String()
+}
+
+// indexTaxonomies groups the indexed pages by each configured taxonomy, separately for each language.
+// Every language with pages has its own taxonomies under its prefix, as does the default language.
+func (pb *PageBuilder) indexTaxonomies() {
+	pb.taxonomies = make(map[string]map[string]*Taxonomy)
+
+	langs := map[string]bool{pb.Opts.Languages.Default: true}
+	for _, page := range pb.pages {
+		langs[page.Lang] = true
+	}
+
+	for _, lang := range slices.Sorted(maps.Keys(langs)) {
+		pb.taxonomies[lang] = make(map[string]*Taxonomy)
+
+		for _, name := range pb.Opts.Taxonomies {
+			taxonomy := pb.indexTaxonomy(lang, name)
+			pb.taxonomies[lang][name] = taxonomy
+
+			if pb.Opts.UseSitemap {
+				if pb.rendersTaxonomyPage(taxonomyTemplate, taxonomy.Path) {
+					pb.sitemap.AddURL(taxonomy.Path, "", "", "")
+				}
+				for _, term := range taxonomy.Terms {
+					if pb.rendersTaxonomyPage(termTemplate, term.Path) {
+						pb.sitemap.AddURL(term.Path, "", "", "")
+					}
+				}
+			}
+		}
+	}
+}
+
+// indexTaxonomy groups the pages in a language by the taxonomy called name.
+func (pb *PageBuilder) indexTaxonomy(lang, name string) *Taxonomy {
+	taxonomy := &Taxonomy{
+		Name:  name,
+		Lang:  lang,
+		Path:  pb.Opts.Languages.Prefix(lang) + "/" + slugify(name),
+		Terms: make([]*Term, 0),
+	}
+
+	// pages are visited in order, so that a term written differently on different pages always
+	// takes the same name
+	terms := make(map[string]*Term)
+	for _, relPath := range slices.Sorted(maps.Keys(pb.pages)) {
+		page := pb.pages[relPath]
+		if page.Lang != lang || isNotFound(relPath) {
+			continue // the not found page isn't listed anywhere
+		}
+
+		seen := make(map[string]bool)
+		for _, name := range page.Taxonomies[taxonomy.Name] {
+			name = normaliseTerm(name)
+			slug := slugify(name)
+			if slug == "" || seen[slug] {
+				continue // a page lists each term once, however many ways it's written
+			}
+			seen[slug] = true
+
+			term, ok := terms[slug]
+			if !ok {
+				term = &Term{
+					Name:  name,
+					Slug:  slug,
+					Path:  taxonomy.Path + "/" + slug,
+					Pages: make([]Lite, 0),
+				}
+				terms[slug] = term
+				taxonomy.Terms = append(taxonomy.Terms, term)
+			}
+
+			term.Pages = append(term.Pages, page.Lite())
+			term.Count++
+		}
+	}
+
+	slices.SortFunc(taxonomy.Terms, func(a, b *Term) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	for _, term := range taxonomy.Terms {
+		sortByDate(term.Pages)
+	}
+
+	return taxonomy
+}
+
+// rendersTaxonomyPage reports whether a taxonomy or term page at relPath is rendered with the template
+// called name, which it isn't if the template doesn't exist or content already exists at its path.
+func (pb *PageBuilder) rendersTaxonomyPage(name, relPath string) bool {
+	_, exists := pb.pages[relPath]
+	return !exists && pb.templates.Lookup(name) != nil
+}
+
+// buildTaxonomies renders the term list and term listing pages for every taxonomy in every language.
+func (pb *PageBuilder) buildTaxonomies() error {
+	type taxonomyPage struct {
+		template string
+		taxonomy *Taxonomy
+		term     *Term
+	}
+
+	pages := make([]taxonomyPage, 0)
+	for _, lang := range slices.Sorted(maps.Keys(pb.taxonomies)) {
+		for _, name := range pb.Opts.Taxonomies {
+			taxonomy := pb.taxonomies[lang][name]
+			pages = append(pages, taxonomyPage{taxonomyTemplate, taxonomy, nil})
+
+			for _, term := range taxonomy.Terms {
+				pages = append(pages, taxonomyPage{termTemplate, taxonomy, term})
+			}
+		}
+	}
+
+	return pb.parallel(len(pages), func(i int) error {
+		return pb.buildTaxonomyPage(pages[i].template, pages[i].taxonomy, pages[i].term)
+	})
+}
+
+func (pb *PageBuilder) buildTaxonomyPage(name string, taxonomy *Taxonomy, term *Term) error {
+	data := PageData{
+		Title:      taxonomy.Name,
+		Content:    pb.devContent(),
+		PageMap:    pb.pageMap,
+		SiteData:   pb.data,
+		Path:       taxonomy.Path,
+		Taxonomies: pb.taxonomies[taxonomy.Lang],
+		Taxonomy:   taxonomy,
+		Lang:       taxonomy.Lang,
+	}
+
+	if term != nil {
+		data.Title = term.Name
+		data.Path = term.Path
+		data.Children = term.Pages
+		data.Term = term
+	}
+
+	data.Permalink = permalink(pb.Opts.BaseURL, data.Path)
+
+	if _, ok := pb.pages[data.Path]; ok {
+		pb.warn("content already exists at taxonomy path, skipping", "path", data.Path)
+		return nil
+	}
+
+	if pb.templates.Lookup(name) == nil {
+		pb.warn("failed to find template, skipping", "path", data.Path, "template", name)
+		return nil
+	}
+
+	return pb.renderPage(name, "", path.Join(data.Path, "index.html"), data)
+}
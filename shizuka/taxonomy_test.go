@@ -0,0 +1,79 @@
+package shizuka
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestIndexTaxonomies(t *testing.T) {
+	fsys := fstest.MapFS{
+		"templates/page.tmpl": {Data: []byte(`{{ .Title }}`)},
+		"templates/term.tmpl": {Data: []byte(`{{ .Term.Count }}:{{ range .Term.Pages }} {{ .Path }}{{ end }}`)},
+		"content/a.md":        {Data: []byte("---\ntemplate: \"page.tmpl\"\ntags: [\"Go\", \"go\", \" GO \"]\n---\n")},
+		"content/b.md":        {Data: []byte("---\ntemplate: \"page.tmpl\"\ntags: [\"go\"]\n---\n")},
+		"content/404.md":      {Data: []byte("---\ntemplate: \"page.tmpl\"\ntags: [\"go\"]\n---\n")},
+	}
+
+	out := NewMapOutput()
+	pb := NewPageBuilder(fsys, out)
+	pb.Opts = BuildOpts{Taxonomies: []string{"tags"}, UseSitemap: true}
+
+	if err := pb.Index(); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	if err := pb.Build(); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	if got, want := string(out.Files["tags/go/index.html"]), "2: /a /b"; got != want {
+		t.Errorf("term page %q, want %q", got, want)
+	}
+
+	// without taxonomy.tmpl there's no page at /tags to list
+	if _, ok := out.Files["tags/index.html"]; ok {
+		t.Errorf("tags/index.html written without taxonomy.tmpl")
+	}
+	listed := make(map[string]bool)
+	for _, url := range pb.sitemap.URLs {
+		listed[url.Loc] = true
+	}
+	if listed["/tags"] {
+		t.Errorf("sitemap lists /tags, which isn't rendered")
+	}
+	if !listed["/tags/go"] {
+		t.Errorf("sitemap doesn't list /tags/go")
+	}
+}
+
+func TestIndexTaxonomiesPerLanguage(t *testing.T) {
+	fsys := fstest.MapFS{
+		"templates/page.tmpl": {Data: []byte(`{{ .Title }}`)},
+		"templates/term.tmpl": {Data: []byte(`{{ .Lang }}:{{ range .Term.Pages }} {{ .Path }}{{ end }}`)},
+		"content/a.md":        {Data: []byte("---\ntemplate: \"page.tmpl\"\ntags: [\"go\"]\n---\n")},
+		"content/a.ja.md":     {Data: []byte("---\ntemplate: \"page.tmpl\"\ntags: [\"go\"]\n---\n")},
+		"content/b.ja.md":     {Data: []byte("---\ntemplate: \"page.tmpl\"\ntags: [\"go\"]\n---\n")},
+	}
+
+	out := NewMapOutput()
+	pb := NewPageBuilder(fsys, out)
+	pb.Opts = testOpts()
+	pb.Opts.Related = RelatedOpts{}
+	pb.Opts.Taxonomies = []string{"tags"}
+
+	if err := pb.Index(); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	if err := pb.Build(); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	terms := map[string]string{
+		"tags/go/index.html":    "en: /a",
+		"ja/tags/go/index.html": "ja: /ja/a /ja/b",
+	}
+	for name, want := range terms {
+		if got := string(out.Files[name]); got != want {
+			t.Errorf("%s: %q, want %q", name, got, want)
+		}
+	}
+}